@@ -5,8 +5,11 @@ package hcat
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/hashicorp/hcat/events"
 )
 
 // timers is a threadsafe object to manage multiple timers that represent
@@ -17,14 +20,24 @@ type timers struct {
 	timers   map[string]*timer
 	buffered map[string]bool
 	ch       chan string
+	// limits is the map of IDs to their rate limits, limitCh receives the
+	// IDs whose rate limit delay ended. They aren't buffered.
+	limits  map[string]*rateLimit
+	limitCh chan string
+	// event is passed on to the timers to report buffer period changes
+	event events.EventHandler
+	// quit is closed by Halt to make Run return
+	quit     chan struct{}
+	quitOnce sync.Once
 }
 
 // timer is an internal representation of a single buffer state.
 type timer struct {
 	mux sync.RWMutex
 
-	id string
-	ch chan string
+	id    string
+	ch    chan string
+	event events.EventHandler
 
 	deadline time.Time
 	min      time.Duration
@@ -48,21 +61,36 @@ func newTimers() *timers {
 		timers:   make(map[string]*timer),
 		buffered: make(map[string]bool),
 		ch:       make(chan string, 10),
+		limits:   make(map[string]*rateLimit),
+		limitCh:  make(chan string, 10),
+		event:    func(events.Event) {},
+		quit:     make(chan struct{}),
 	}
 }
 
 // Run is a blocking function to monitor timers and notify the channel
-// a buffer period has completed.
+// a buffer period or a rate limit delay has completed.
 func (t *timers) Run(triggerCh chan string) {
 	for {
-		id, ok := <-t.ch
-		if !ok {
+		var id string
+		select {
+		case tid, ok := <-t.ch:
+			if !ok {
+				return
+			}
+			id = tid
+			t.mux.Lock()
+			t.buffered[id] = true
+			t.mux.Unlock()
+		case id = <-t.limitCh:
+		case <-t.quit:
+			return
+		}
+		select {
+		case triggerCh <- id:
+		case <-t.quit:
 			return
 		}
-		t.mux.Lock()
-		t.buffered[id] = true
-		t.mux.Unlock()
-		triggerCh <- id
 	}
 }
 
@@ -76,6 +104,15 @@ func (t *timers) Stop() {
 		timer.stop()
 		delete(t.timers, id)
 	}
+	for _, limit := range t.limits {
+		limit.stop()
+	}
+}
+
+// Halt stops the timers and makes Run return.
+func (t *timers) Halt() {
+	t.Stop()
+	t.quitOnce.Do(func() { close(t.quit) })
 }
 
 // Add a new timer and returns if the timer was added.
@@ -88,6 +125,7 @@ func (t *timers) Add(min, max time.Duration, id string) bool {
 	}
 
 	t.timers[id] = newTimer(t.ch, min, max, id)
+	t.timers[id].event = t.event
 	return true
 }
 
@@ -99,6 +137,36 @@ func (t *timers) Buffered(id string) bool {
 	return t.buffered[id]
 }
 
+// BufferState is the state of a template's buffer period.
+type BufferState struct {
+	// ID is the template (notifier) ID.
+	ID string
+	// Min and Max are the configured buffer period.
+	Min time.Duration
+	Max time.Duration
+	// Active is true while changes are being buffered, the template is
+	// notified when the buffer period ends.
+	Active bool
+	// Deadline is when the active buffer period ends at the latest (Max
+	// after it started). It is zero if the buffer period isn't active.
+	Deadline time.Time
+}
+
+// States returns the state of all the buffer periods, sorted by ID.
+func (t *timers) States() []BufferState {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	states := make([]BufferState, 0, len(t.timers))
+	for _, timer := range t.timers {
+		states = append(states, timer.state())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ID < states[j].ID
+	})
+	return states
+}
+
 // isBuffering tests whether buffing is currently in use
 func (t *timers) isBuffering(id string) bool {
 	_, ok := t.timers[id]
@@ -114,11 +182,16 @@ func (t *timers) tick(id string) bool {
 // tick with 'now' passed in to allow testing
 func (t *timers) _tick(id string, now time.Time) bool {
 	t.mux.Lock()
-	defer t.mux.Unlock()
-
 	timer, ok := t.timers[id]
+	var e events.Event
 	if ok {
-		timer.tick(now)
+		e = timer.tick(now)
+	}
+	t.mux.Unlock()
+
+	// outside the lock, in case the handler looks up the buffer states
+	if e != nil {
+		t.event(e)
 	}
 	return ok
 }
@@ -143,6 +216,12 @@ func (t *timers) testAdd(min, max time.Duration, id string) bool {
 	return ok
 }
 
+// set rate limit using test version of time.Timer
+func (t *timers) testSetRateLimit(every time.Duration, burst int, id string) {
+	t.SetRateLimit(every, burst, id)
+	t.limits[id].newTimerer = NewTestTimer
+}
+
 // returns the timer for id
 func (t *timers) get(id string) *timer {
 	t.mux.Lock()
@@ -154,14 +233,53 @@ func (t *timers) get(id string) *timer {
 	return nil
 }
 
+// SetRateLimit limits how often the ID is let through by allow to once
+// every interval, with bursts of up to burst. A zero interval removes the
+// limit.
+func (t *timers) SetRateLimit(every time.Duration, burst int, id string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if limit, ok := t.limits[id]; ok {
+		limit.stop()
+		delete(t.limits, id)
+	}
+	if every <= 0 {
+		return
+	}
+	t.limits[id] = newRateLimit(t.limitCh, t.quit, every, burst, id,
+		time.Now())
+}
+
+// allow takes a token from the ID's rate limit, returning true if the ID can
+// be notified now. Otherwise it returns the delay until the next token, when
+// the ID is sent to the channel to be notified then. IDs without a rate limit
+// are always allowed.
+func (t *timers) allow(id string) (bool, time.Duration) {
+	return t._allow(id, time.Now())
+}
+
+// allow with 'now' passed in to allow testing
+func (t *timers) _allow(id string, now time.Time) (bool, time.Duration) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	limit, ok := t.limits[id]
+	if !ok {
+		return true, 0
+	}
+	return limit.allow(now)
+}
+
 // //////////////////////////////////////////////////////////////////////
 // newTimer creates a new buffer timer for the given template.
 func newTimer(ch chan string, min, max time.Duration, id string) *timer {
 	return &timer{
-		id:  id,
-		min: min,
-		max: max,
-		ch:  ch,
+		id:    id,
+		min:   min,
+		max:   max,
+		ch:    ch,
+		event: func(events.Event) {},
 		// change to use test timer in tests
 		newTimerer: NewRealTimer,
 	}
@@ -173,14 +291,24 @@ func (t *timer) stop() {
 	}
 }
 
-// tick updates the minimum buffer timer
-func (t *timer) tick(now time.Time) {
+// tick updates the minimum buffer timer and returns the buffer event to
+// report, if any.
+func (t *timer) tick(now time.Time) events.Event {
 	if t.active() {
-		t.activeTick(now)
-		return
+		return t.activeTick(now)
 	}
 
-	t.inactiveTick(now)
+	return t.inactiveTick(now)
+}
+
+func (t *timer) state() BufferState {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	state := BufferState{ID: t.id, Min: t.min, Max: t.max, Active: t.isActive}
+	if t.isActive {
+		state.Deadline = t.deadline
+	}
+	return state
 }
 
 func (t *timer) active() bool {
@@ -191,7 +319,7 @@ func (t *timer) active() bool {
 
 // inactiveTick is the first tick of a buffer period, set up the timer and
 // calculate the max deadline.
-func (t *timer) inactiveTick(now time.Time) {
+func (t *timer) inactiveTick(now time.Time) events.Event {
 	if t.timer == nil {
 		t.timer = t.newTimerer(t.min)
 	} else {
@@ -203,6 +331,7 @@ func (t *timer) inactiveTick(now time.Time) {
 	t.isActive = true
 	t.deadline = now.Add(t.max) // reset the deadline ot the future
 	t.cancelTick = cancel
+	deadline := t.deadline
 	t.mux.Unlock()
 
 	go func(ctx context.Context) {
@@ -210,31 +339,38 @@ func (t *timer) inactiveTick(now time.Time) {
 		case <-ctx.Done():
 			return
 		case <-t.timer.GetC():
+			t.event(events.BufferTrigger{ID: t.id})
 			t.mux.Lock()
 			t.ch <- t.id
 			t.isActive = false
 			t.mux.Unlock()
 		}
 	}(ctx)
+
+	return events.BufferStart{ID: t.id, Wait: t.min, Deadline: deadline}
 }
 
 // activeTick snoozes the timer for the min time, or snooze less if we are coming
 // up against the max time.
-func (t *timer) activeTick(now time.Time) {
+func (t *timer) activeTick(now time.Time) events.Event {
 	// Wait for the lock in case the go routine is updating the active state.
 	// If the timer has already fired don't snooze and let the next tick reset
 	// the buffer period to active
 	t.mux.Lock()
 	defer t.mux.Unlock()
 	if !t.isActive {
-		return
+		return nil
 	}
 
 	if now.Add(t.min).Before(t.deadline) {
 		t.timer.Reset(t.min)
-	} else if dur := t.deadline.Sub(now); dur > 0 {
+		return events.BufferExtend{ID: t.id, Wait: t.min, Deadline: t.deadline}
+	}
+	// can't snooze past the max deadline, the timer fires at it
+	if dur := t.deadline.Sub(now); dur > 0 {
 		t.timer.Reset(dur)
 	}
+	return events.BufferDeadline{ID: t.id, Deadline: t.deadline}
 }
 
 // reset resets the timer to inactive
@@ -249,17 +385,125 @@ func (t *timer) reset() {
 	t.isActive = false
 }
 
+// //////////////////////////////////////////////////////////////////////
+// rateLimit is a token bucket limiting how often a template is notified.
+type rateLimit struct {
+	mux sync.Mutex
+
+	id string
+	ch chan string
+	// quit is the timers' quit channel, no one receives on ch once closed
+	quit chan struct{}
+
+	every  time.Duration
+	burst  int
+	tokens int
+	last   time.Time // time of the last token refill
+
+	// timer fires a delayed notification once a token is available
+	timer      timerer
+	newTimerer func(d time.Duration) timerer
+	cancelWait context.CancelFunc
+}
+
+func newRateLimit(ch chan string, quit chan struct{}, every time.Duration,
+	burst int, id string, now time.Time,
+) *rateLimit {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimit{
+		id:         id,
+		ch:         ch,
+		quit:       quit,
+		every:      every,
+		burst:      burst,
+		tokens:     burst,
+		last:       now,
+		newTimerer: NewRealTimer,
+	}
+}
+
+// refill adds the tokens earned since the last refill, up to burst.
+func (r *rateLimit) refill(now time.Time) {
+	earned := int(now.Sub(r.last) / r.every)
+	if earned <= 0 {
+		return
+	}
+	r.tokens += earned
+	r.last = r.last.Add(time.Duration(earned) * r.every)
+	if r.tokens >= r.burst {
+		r.tokens = r.burst
+		r.last = now
+	}
+}
+
+// allow takes a token if there is one. If not, it returns the delay until
+// the next one and starts the timer to send the ID on the channel then.
+func (r *rateLimit) allow(now time.Time) (bool, time.Duration) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.refill(now)
+	if r.tokens > 0 {
+		r.tokens--
+		return true, 0
+	}
+
+	delay := r.every - now.Sub(r.last)
+	if r.cancelWait != nil { // delayed notification already pending
+		return false, delay
+	}
+
+	if r.timer == nil {
+		r.timer = r.newTimerer(delay)
+	} else {
+		r.timer.Reset(delay)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancelWait = cancel
+
+	go func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.timer.GetC():
+			r.mux.Lock()
+			r.cancelWait = nil
+			r.mux.Unlock()
+			cancel()
+			select {
+			case r.ch <- r.id:
+			case <-r.quit:
+			}
+		}
+	}(ctx)
+	return false, delay
+}
+
+func (r *rateLimit) stop() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.cancelWait != nil {
+		r.cancelWait()
+		r.cancelWait = nil
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+}
+
 // //////////////////////////////////////////////////////////////////////
 // time.Timer wrapper and a mocked/test Timer implementation
 // They both meet the `timerer` interface above
 
 // time.Timer wrapped to fit the interface (needed a getter for the channel)
 type realTimer struct {
-	time.Timer
+	*time.Timer
 }
 
 func NewRealTimer(d time.Duration) timerer {
-	return &realTimer{*time.NewTimer(d)}
+	return &realTimer{time.NewTimer(d)}
 }
 
 func (tt *realTimer) GetC() <-chan time.Time {
@@ -5,9 +5,11 @@ package hcat
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/hcat/events"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -192,4 +194,150 @@ func TestBufferPeriod(t *testing.T) {
 		bufferPeriods.Reset(id)
 		assert.False(t, bufferPeriods.timers[id].active())
 	})
+	t.Run("rate limit", func(t *testing.T) {
+		triggerCh := make(chan string, 5)
+		bufferPeriods := newTimers()
+		go bufferPeriods.Run(triggerCh)
+		defer bufferPeriods.Stop()
+
+		id := "foo"
+		bufferPeriods.testSetRateLimit(time.Minute, 2, id)
+		now := time.Now()
+
+		// burst of 2 then limited
+		for i := 0; i < 2; i++ {
+			ok, _ := bufferPeriods._allow(id, now)
+			assert.True(t, ok, "should be allowed within burst")
+		}
+		ok, delay := bufferPeriods._allow(id, now)
+		assert.False(t, ok, "should be limited after burst")
+		assert.True(t, delay > 59*time.Second && delay <= time.Minute,
+			"bad delay: %s", delay)
+
+		// limited again while the delayed notification is pending
+		ok, _ = bufferPeriods._allow(id, now.Add(time.Second))
+		assert.False(t, ok)
+
+		timer := bufferPeriods.limits[id].timer.(*testTimer)
+		timer.send() // fake the delay expiring
+		assert.Equal(t, id, <-triggerCh)
+
+		ok, _ = bufferPeriods._allow(id, now.Add(time.Minute))
+		assert.True(t, ok, "should be allowed after a token is added")
+
+		ok, _ = bufferPeriods._allow("bar", now)
+		assert.True(t, ok, "no rate limit, should be allowed")
+
+		bufferPeriods.SetRateLimit(0, 0, id)
+		ok, _ = bufferPeriods._allow(id, now)
+		assert.True(t, ok, "rate limit removed, should be allowed")
+	})
+
+	t.Run("rate limit after halt", func(t *testing.T) {
+		bufferPeriods := newTimers()
+		id := "foo"
+		bufferPeriods.testSetRateLimit(time.Minute, 1, id)
+		// fill the channel, as if Run stopped receiving on halting
+		for i := 0; i < cap(bufferPeriods.limitCh); i++ {
+			bufferPeriods.limitCh <- id
+		}
+		now := time.Now()
+		bufferPeriods._allow(id, now)
+		bufferPeriods._allow(id, now) // limited, delayed notification
+
+		timer := bufferPeriods.limits[id].timer.(*testTimer)
+		timer.send() // the delay ends
+		bufferPeriods.Halt()
+
+		// the delayed notification gives up instead of blocking on the send
+		for i := 0; i < cap(bufferPeriods.limitCh); i++ {
+			<-bufferPeriods.limitCh
+		}
+		select {
+		case <-bufferPeriods.limitCh:
+			t.Error("delayed notification sent after halting")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("rate limit refill", func(t *testing.T) {
+		now := time.Now()
+		limit := newRateLimit(nil, nil, time.Second, 3, "foo", now)
+		limit.tokens = 0
+
+		limit.refill(now.Add(2500 * time.Millisecond))
+		assert.Equal(t, 2, limit.tokens)
+		assert.Equal(t, now.Add(2*time.Second), limit.last)
+
+		limit.refill(now.Add(time.Hour))
+		assert.Equal(t, 3, limit.tokens, "tokens capped at burst")
+	})
+	t.Run("rate limit and buffer", func(t *testing.T) {
+		triggerCh := make(chan string, 5)
+		bufferPeriods := newTimers()
+		go bufferPeriods.Run(triggerCh)
+		defer bufferPeriods.Stop()
+
+		id := "foo"
+		bufferPeriods.testAdd(2*time.Millisecond, 8*time.Millisecond, id)
+		bufferPeriods.testSetRateLimit(time.Minute, 1, id)
+		now := time.Now()
+		bufferPeriods._allow(id, now)
+		ok, _ := bufferPeriods._allow(id, now)
+		assert.False(t, ok, "should be limited after burst")
+		bufferPeriods._tick(id, now) // activate buffer
+
+		// the rate limit's delay ending doesn't end the buffer period
+		bufferPeriods.limits[id].timer.(*testTimer).send()
+		assert.Equal(t, id, <-triggerCh)
+		assert.False(t, bufferPeriods.Buffered(id),
+			"rate limit shouldn't mark the id buffered")
+		assert.True(t, bufferPeriods.timers[id].active(),
+			"buffer period should still be active")
+
+		getTestTimer(bufferPeriods, id).send()
+		assert.Equal(t, id, <-triggerCh)
+		assert.True(t, bufferPeriods.Buffered(id))
+	})
+
+	t.Run("events and state", func(t *testing.T) {
+		triggerCh := make(chan string, 5)
+		bufferPeriods := newTimers()
+		var mux sync.Mutex
+		var got []events.Event
+		bufferPeriods.event = func(e events.Event) {
+			mux.Lock()
+			defer mux.Unlock()
+			got = append(got, e)
+		}
+		go bufferPeriods.Run(triggerCh)
+		defer bufferPeriods.Stop()
+
+		id := "foo"
+		min, max := 4*time.Millisecond, 6*time.Millisecond
+		bufferPeriods.testAdd(min, max, id)
+		assert.Equal(t, []BufferState{{ID: id, Min: min, Max: max}},
+			bufferPeriods.States())
+
+		now := time.Now()
+		deadline := now.Add(max)
+		bufferPeriods._tick(id, now)                         // start
+		bufferPeriods._tick(id, now.Add(time.Millisecond))   // extend
+		bufferPeriods._tick(id, now.Add(3*time.Millisecond)) // deadline
+		assert.Equal(t, []BufferState{{ID: id, Min: min, Max: max,
+			Active: true, Deadline: deadline}}, bufferPeriods.States())
+
+		getTestTimer(bufferPeriods, id).send()
+		assert.Equal(t, id, <-triggerCh)
+		assert.False(t, bufferPeriods.States()[0].Active)
+
+		mux.Lock()
+		defer mux.Unlock()
+		assert.Equal(t, []events.Event{
+			events.BufferStart{ID: id, Wait: min, Deadline: deadline},
+			events.BufferExtend{ID: id, Wait: min, Deadline: deadline},
+			events.BufferDeadline{ID: id, Deadline: deadline},
+			events.BufferTrigger{ID: id},
+		}, got)
+	})
 }
@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcat/events"
+)
+
+// EventRecorder keeps the most recent Watcher events in a ring buffer.
+type EventRecorder struct {
+	mux    sync.Mutex
+	events []RecordedEvent
+	next   int
+	full   bool
+	now    func() time.Time
+}
+
+// RecordedEvent is an event as served by the Handler. Fields holds the
+// event's fields, with errors as their message. Data fields are left out,
+// as they can hold secrets.
+type RecordedEvent struct {
+	Time   time.Time
+	Type   string
+	Fields map[string]interface{}
+}
+
+// NewEventRecorder returns an EventRecorder keeping the last size events.
+func NewEventRecorder(size int) *EventRecorder {
+	if size < 1 {
+		size = 1
+	}
+	return &EventRecorder{
+		events: make([]RecordedEvent, size),
+		now:    time.Now,
+	}
+}
+
+// Handler returns an event handler that records the events and passes them
+// on to next, if it isn't nil.
+func (r *EventRecorder) Handler(next events.EventHandler) events.EventHandler {
+	return func(e events.Event) {
+		r.Record(e)
+		if next != nil {
+			next(e)
+		}
+	}
+}
+
+// Record adds the event to the buffer, replacing the oldest one when full.
+func (r *EventRecorder) Record(e events.Event) {
+	re := newRecordedEvent(e, r.now())
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.events[r.next] = re
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Events returns the recorded events, oldest first.
+func (r *EventRecorder) Events() []RecordedEvent {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if !r.full {
+		return append([]RecordedEvent{}, r.events[:r.next]...)
+	}
+	result := make([]RecordedEvent, 0, len(r.events))
+	result = append(result, r.events[r.next:]...)
+	return append(result, r.events[:r.next]...)
+}
+
+func newRecordedEvent(e events.Event, now time.Time) RecordedEvent {
+	v := reflect.ValueOf(e)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	re := RecordedEvent{
+		Time:   now,
+		Type:   v.Type().Name(),
+		Fields: make(map[string]interface{}),
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || field.Name == "Data" {
+			continue
+		}
+		value := v.Field(i).Interface()
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		re.Fields[field.Name] = value
+	}
+	return re
+}
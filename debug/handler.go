@@ -0,0 +1,179 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package debug provides an http.Handler to inspect a running Watcher. It
+// serves JSON documents, relative to where it is mounted:
+//
+//	/views    the watched dependencies and their status
+//	/tracked  the templates (notifiers) and the dependencies they use
+//	/cache    the cached values by dependency, redacted but for catalog,
+//	          health and Nomad service data
+//	/events   the recent events, if an EventRecorder is given
+//	/buffers  the templates' buffer period state
+//
+// To mount it in an existing admin server, strip the prefix, eg.
+//
+//	rec := debug.NewEventRecorder(100)
+//	w := hcat.NewWatcher(hcat.WatcherInput{
+//		Cache:        store,
+//		EventHandler: rec.Handler(logEvent),
+//	})
+//	h := debug.NewHandler(debug.HandlerInput{
+//		Watcher: w, Cache: store, Events: rec,
+//	})
+//	mux.Handle("/debug/hcat/", http.StripPrefix("/debug/hcat", h))
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/hashicorp/hcat"
+	"github.com/hashicorp/hcat/dep"
+)
+
+// Redacted replaces secret values in the responses.
+const Redacted = "[redacted]"
+
+// HandlerInput is used as input to the NewHandler function.
+type HandlerInput struct {
+	// Watcher is the watcher to inspect. Required.
+	Watcher *hcat.Watcher
+	// Cache is the cache given to the Watcher, used to serve /cache.
+	Cache hcat.Cacher
+	// Events records the events to serve with /events.
+	Events *EventRecorder
+}
+
+// Handler is an http.Handler serving the state of a Watcher.
+type Handler struct {
+	watcher *hcat.Watcher
+	cache   hcat.Cacher
+	events  *EventRecorder
+}
+
+// NewHandler returns a Handler for the watcher.
+func NewHandler(i HandlerInput) *Handler {
+	return &Handler{
+		watcher: i.Watcher,
+		cache:   i.Cache,
+		events:  i.Events,
+	}
+}
+
+// ServeHTTP serves the endpoint named by the path, which must match it
+// exactly once cleaned.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// the path is relative to the mount point, with or without the slash
+	switch path.Clean("/" + r.URL.Path) {
+	case "/":
+		writeJSON(w, []string{"views", "tracked", "cache", "events", "buffers"})
+	case "/views":
+		writeJSON(w, h.watcher.Snapshot().Views)
+	case "/tracked":
+		writeJSON(w, h.watcher.Snapshot().Notifiers)
+	case "/cache":
+		if h.cache == nil {
+			writeError(w, http.StatusNotFound, "no cache configured")
+			return
+		}
+		writeJSON(w, h.cached())
+	case "/events":
+		if h.events == nil {
+			writeError(w, http.StatusNotFound, "no event recorder configured")
+			return
+		}
+		writeJSON(w, h.events.Events())
+	case "/buffers":
+		writeJSON(w, h.watcher.BufferStates())
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// CachedValue is a cached dependency value.
+type CachedValue struct {
+	ID    string
+	Kind  string
+	Value interface{}
+}
+
+// cached returns the cached values of the watched dependencies, sorted by ID.
+func (h *Handler) cached() []CachedValue {
+	views := h.watcher.Snapshot().Views
+	values := make([]CachedValue, 0, len(views))
+	for _, v := range views {
+		value, ok := h.cache.Recall(v.ID)
+		if !ok {
+			continue
+		}
+		values = append(values, CachedValue{
+			ID:    v.ID,
+			Kind:  v.Kind,
+			Value: redact(value),
+		})
+	}
+	return values
+}
+
+// redactedSecret is a Vault secret with only the keys of its data.
+type redactedSecret struct {
+	LeaseDuration int
+	Renewable     bool
+	Keys          []string
+}
+
+// redact removes the values that may be secret, only the Consul catalog and
+// health data, the Nomad services and lists of keys or paths are kept. Vault
+// secrets and Nomad variables keep the keys of their data.
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []*dep.HealthService, []*dep.Node, *dep.CatalogNode,
+		[]*dep.CatalogSnippet, []*dep.GatewayService, []string:
+		return v
+	case []*dep.NomadService, []*dep.NomadServicesSnippet:
+		// service discovery data, like the Consul catalog and health data
+		return v
+	case *dep.Secret:
+		keys := make([]string, 0, len(v.Data))
+		for k := range v.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return redactedSecret{
+			LeaseDuration: v.LeaseDuration,
+			Renewable:     v.Renewable,
+			Keys:          keys,
+		}
+	case dep.NomadVarItems:
+		items := make(map[string]string, len(v))
+		for k := range v {
+			items[k] = Redacted
+		}
+		return items
+	}
+	return Redacted
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
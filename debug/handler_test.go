@@ -0,0 +1,262 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat"
+	"github.com/hashicorp/hcat/dep"
+	"github.com/hashicorp/hcat/events"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+type notifier string
+
+func (n notifier) ID() string              { return string(n) }
+func (n notifier) Notify(interface{}) bool { return true }
+
+func get(t *testing.T, ts *httptest.Server, path string, v interface{}) int {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHandler(t *testing.T) {
+	store := hcat.NewStore()
+	rec := NewEventRecorder(10)
+	w := hcat.NewWatcher(hcat.WatcherInput{
+		Clients:      hcat.NewClientSet(),
+		Cache:        store,
+		EventHandler: rec.Handler(nil),
+	})
+	defer w.Stop()
+
+	foo := &idep.FakeDep{Name: "foo"}
+	tmpl := notifier("tmpl")
+	w.Track(tmpl, foo)
+	w.SetBufferPeriod(time.Minute, time.Hour, tmpl.ID())
+	w.Poll(foo)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w.Wait(ctx) // buffered, returns on timeout
+
+	h := NewHandler(HandlerInput{Watcher: w, Cache: store, Events: rec})
+	mux := http.NewServeMux()
+	mux.Handle("/debug/hcat/", http.StripPrefix("/debug/hcat", h))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	t.Run("index", func(t *testing.T) {
+		var index []string
+		get(t, ts, "/debug/hcat/", &index)
+		if len(index) != 5 {
+			t.Errorf("bad index: %v", index)
+		}
+	})
+
+	t.Run("views", func(t *testing.T) {
+		var views []hcat.ViewSnapshot
+		get(t, ts, "/debug/hcat/views", &views)
+		if len(views) != 1 || views[0].ID != foo.ID() ||
+			!views[0].ReceivedData {
+			t.Errorf("bad views: %+v", views)
+		}
+	})
+
+	t.Run("tracked", func(t *testing.T) {
+		var tracked []hcat.NotifierSnapshot
+		get(t, ts, "/debug/hcat/tracked", &tracked)
+		exp := []hcat.NotifierSnapshot{
+			{ID: "tmpl", Dependencies: []string{foo.ID()}},
+		}
+		if !reflect.DeepEqual(exp, tracked) {
+			t.Errorf("bad tracked\nexp: %+v\nact: %+v", exp, tracked)
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		var cached []CachedValue
+		get(t, ts, "/debug/hcat/cache", &cached)
+		exp := []CachedValue{{ID: foo.ID(), Kind: "consul", Value: Redacted}}
+		if !reflect.DeepEqual(exp, cached) {
+			t.Errorf("bad cache\nexp: %+v\nact: %+v", exp, cached)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		var recorded []RecordedEvent
+		get(t, ts, "/debug/hcat/events", &recorded)
+		var contacted bool
+		for _, e := range recorded {
+			if e.Type == "ServerContacted" && e.Fields["ID"] == foo.ID() {
+				contacted = true
+			}
+		}
+		if !contacted {
+			t.Errorf("expected a ServerContacted event: %+v", recorded)
+		}
+	})
+
+	t.Run("buffers", func(t *testing.T) {
+		var buffers []hcat.BufferState
+		get(t, ts, "/debug/hcat/buffers", &buffers)
+		if len(buffers) != 1 || buffers[0].ID != "tmpl" || !buffers[0].Active {
+			t.Errorf("bad buffers: %+v", buffers)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		for _, p := range []string{"/debug/hcat/nope", "/debug/hcat/x/y/cache",
+			"/debug/hcat/views/cache"} {
+			if code := get(t, ts, p, nil); code != http.StatusNotFound {
+				t.Errorf("%s: expected 404, got %d", p, code)
+			}
+		}
+	})
+
+	t.Run("method", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/debug/hcat/views", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("unconfigured", func(t *testing.T) {
+		ts := httptest.NewServer(NewHandler(HandlerInput{Watcher: w}))
+		defer ts.Close()
+		for _, p := range []string{"/cache", "/events"} {
+			if code := get(t, ts, p, nil); code != http.StatusNotFound {
+				t.Errorf("%s: expected 404, got %d", p, code)
+			}
+		}
+	})
+}
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		exp   interface{}
+	}{
+		{
+			"secret",
+			&dep.Secret{
+				LeaseDuration: 60,
+				Data:          map[string]interface{}{"b": "x", "a": "y"},
+			},
+			redactedSecret{LeaseDuration: 60, Keys: []string{"a", "b"}},
+		},
+		{
+			"list",
+			[]string{"foo", "bar"},
+			[]string{"foo", "bar"},
+		},
+		{
+			"vault_token",
+			"s.token",
+			Redacted,
+		},
+		{
+			"nomad_var",
+			dep.NomadVarItems{"user": "admin"},
+			map[string]string{"user": Redacted},
+		},
+		{
+			"kv",
+			dep.KvValue("password"),
+			Redacted,
+		},
+		{
+			"kv_list",
+			[]*dep.KeyPair{{Key: "db", Value: "password"}},
+			Redacted,
+		},
+		{
+			"custom",
+			map[string]string{"token": "secret"},
+			Redacted,
+		},
+		{
+			"health",
+			[]*dep.HealthService{{Name: "web"}},
+			[]*dep.HealthService{{Name: "web"}},
+		},
+		{
+			"catalog",
+			[]*dep.CatalogSnippet{{Name: "web"}},
+			[]*dep.CatalogSnippet{{Name: "web"}},
+		},
+		{
+			"nomad_service",
+			[]*dep.NomadService{{Name: "web", Address: "10.0.0.1", Port: 8080}},
+			[]*dep.NomadService{{Name: "web", Address: "10.0.0.1", Port: 8080}},
+		},
+		{
+			"nomad_services",
+			[]*dep.NomadServicesSnippet{{Name: "web", Tags: dep.ServiceTags{"v1"}}},
+			[]*dep.NomadServicesSnippet{{Name: "web", Tags: dep.ServiceTags{"v1"}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if act := redact(tc.value); !reflect.DeepEqual(tc.exp, act) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.exp, act)
+			}
+		})
+	}
+}
+
+func TestEventRecorder(t *testing.T) {
+	rec := NewEventRecorder(3)
+	var passed int
+	h := rec.Handler(func(events.Event) { passed++ })
+
+	for _, id := range []string{"a", "b", "c"} {
+		h(events.ServerError{ID: id, Error: errors.New("boom")})
+	}
+	h(events.NewData{ID: "d", Data: "secret"})
+	if passed != 4 {
+		t.Errorf("expected events passed on, got %d", passed)
+	}
+
+	recorded := rec.Events()
+	if len(recorded) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(recorded))
+	}
+	for i, id := range []string{"b", "c"} {
+		e := recorded[i]
+		if e.Type != "ServerError" || e.Fields["ID"] != id ||
+			e.Fields["Error"] != "boom" {
+			t.Errorf("bad event %d: %+v", i, e)
+		}
+	}
+	e := recorded[2]
+	if _, ok := e.Fields["Data"]; ok || e.Type != "NewData" ||
+		e.Fields["ID"] != "d" {
+		t.Errorf("event data should be left out: %+v", e)
+	}
+}
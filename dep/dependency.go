@@ -25,10 +25,113 @@ type Clients interface {
 	Vault() *vaultapi.Client
 }
 
+// NamedClients is for Clients that also hold other clients by name, for
+// dependencies that need something besides Consul and Vault (eg. a Nomad
+// client or a database handle).
+type NamedClients interface {
+	Client(name string) (interface{}, bool)
+}
+
+// Client returns the client with the name from the Clients, if there is one
+// and it is of type T.
+func Client[T any](c Clients, name string) (T, bool) {
+	var client T
+	nc, ok := c.(NamedClients)
+	if !ok {
+		return client, false
+	}
+	v, ok := nc.Client(name)
+	if !ok {
+		return client, false
+	}
+	client, ok = v.(T)
+	return client, ok
+}
+
 // Metadata returned by external dependency Fetch-ing.
 // LastIndex is used with the Consul backend. Needed to track changes.
 // LastContact is used to help calculate staleness of records.
+// QueryBackend is the Consul backend that served the query, "streaming" or
+// "blocking-query", if reported.
+// CacheHit and CacheAge are set when the Consul agent cache served the query.
 type ResponseMetadata struct {
-	LastIndex   uint64
-	LastContact time.Duration
+	LastIndex    uint64
+	LastContact  time.Duration
+	QueryBackend string
+	CacheHit     bool
+	CacheAge     time.Duration
+}
+
+// RespWithMetadata is a short wrapper to return the given data with fake
+// response metadata for dependencies without an index (non-Consul). The
+// LastIndex is the current time so each fetch is seen as new data, the view
+// checks the data itself for changes.
+func RespWithMetadata(i interface{}) (interface{}, *ResponseMetadata, error) {
+	return i, &ResponseMetadata{
+		LastContact: 0,
+		LastIndex:   uint64(time.Now().Unix()),
+	}, nil
+}
+
+// QueryOptionsSetter is implemented by dependencies to receive the query
+// options (blocking index, wait time, staleness, etc.) before each Fetch.
+type QueryOptionsSetter interface {
+	SetOptions(QueryOptions)
+}
+
+// Interfaces used as type annotations. A dependency gets them by embedding
+// the matching Is* struct below.
+
+// BlockingQuery is for dependencies that use blocking queries. A nil result
+// from Fetch is treated as still waiting and not passed on to templates.
+type BlockingQuery interface {
+	blockingQuery()
+}
+
+// PollingQuery is for dependencies whose endpoints don't support blocking
+// queries. The view waits PollingWait between fetches instead, the first
+// fetch is always immediate.
+type PollingQuery interface {
+	PollingWait() time.Duration
 }
+
+// ConsulType is for dependencies that query Consul.
+type ConsulType interface {
+	Consul()
+}
+
+// VaultType is for dependencies that query Vault.
+type VaultType interface {
+	Vault()
+}
+
+// NomadType is for dependencies that query Nomad.
+type NomadType interface {
+	Nomad()
+}
+
+// FileType is for dependencies that read local files.
+type FileType interface {
+	File()
+}
+
+// Kinder is for dependencies that set their own kind, used by the Watcher to
+// pick the RetryFunc for it. It takes precedence over the type annotations.
+type Kinder interface {
+	Kind() string
+}
+
+// Embed to annotate a dependency with the matching interface.
+type (
+	IsConsul   struct{}
+	IsVault    struct{}
+	IsNomad    struct{}
+	IsFile     struct{}
+	IsBlocking struct{}
+)
+
+func (IsConsul) Consul()          {}
+func (IsVault) Vault()            {}
+func (IsNomad) Nomad()            {}
+func (IsFile) File()              {}
+func (IsBlocking) blockingQuery() {}
@@ -8,9 +8,62 @@ Public Dependency type information.
 This sub-package contains all the required types needed to implement an
 external dependency as used by this library.
 
-It is a sub-package as all the current dependency implentations are contained
-in an internal/ package as it needs some significant refactoring that shouldn't
-interfere with the initial release.
+The included dependency implementations are contained in an internal/ package,
+but everything they use to interact with the Watcher is defined here so
+custom dependencies get the same treatment.
+
+Writing a dependency
+
+A dependency implements Dependency. Fetch returns the data along with
+ResponseMetadata, the LastIndex of which is used to detect changes. Data
+sources without an index can use RespWithMetadata. Clients other than Consul
+and Vault are added by name to the ClientSet (hcat.ClientSet.AddClient) and
+looked up in Fetch with Client, eg.
+
+  client, ok := dep.Client[*nomad.Client](clients, "nomad")
+
+The behavior of the Watcher is controlled by optional interfaces:
+
+  - QueryOptionsSetter receives the QueryOptions (index, wait time,
+    staleness) before each Fetch. Consul based dependencies pass them on
+    with QueryOptions.ToConsulOpts.
+  - BlockingQuery marks a dependency as using blocking queries.
+  - PollingQuery sets the time to wait between fetches for data sources
+    that don't support blocking queries.
+  - ConsulType, VaultType, NomadType and FileType set the dependency's kind,
+    which is used to pick its retry function. Kinder sets a custom kind.
+
+The type annotations are added by embedding the matching struct, eg.
+
+  type MyQuery struct {
+      dep.IsBlocking
+      ...
+  }
+
+Plain errors returned by Fetch are classified by the Watcher, which wraps them
+in a *FetchError with the HTTP status code of Consul, Vault and Nomad API
+errors. Only a 400 (bad request) isn't retried. Return a *FetchError to set
+Retryable yourself, the Watcher passes it on with its ID set to the
+dependency's ID and its Kind set if it is empty.
+
+Registering a dependency
+
+Dependencies are tracked by template functions. A function in the template's
+FuncMapMerge with the signature func(hcat.Recaller) interface{} is called with
+the Recaller, which it uses to look up (and track) its dependency, eg.
+
+  func myQueryFunc(recall hcat.Recaller) interface{} {
+      return func(path string) (string, error) {
+          d := NewMyQuery(path)
+          if value, ok := recall(d); ok {
+              return value.(string), nil
+          }
+          return "", nil
+      }
+  }
+
+A retry function for a custom kind is set with Watcher.SetRetryFunc using
+the value returned by the dependency's Kind method.
 
 */
 package dep
@@ -3,7 +3,11 @@
 
 package dep
 
-import "errors"
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+)
 
 // ErrStopped is a special error that is returned when a dependency is
 // prematurely stopped, usually due to a configuration reload or a process
@@ -14,3 +18,40 @@ var ErrStopped = errors.New("dependency stopped")
 var ErrContinue = errors.New("dependency continue")
 
 var ErrLeaseExpired = errors.New("lease expired or is not renewable")
+
+// FetchError is the error returned when a dependency fails to fetch its data.
+// Use errors.As to get it from the errors returned by the Watcher.
+type FetchError struct {
+	// ID is the ID of the dependency that failed.
+	ID string
+	// Kind is the kind of dependency, eg. "consul", "vault" or "file".
+	Kind string
+	// StatusCode is the HTTP status code of the failed request. It is zero
+	// if the error wasn't an HTTP response, like a network error.
+	StatusCode int
+	// Retryable is false when retrying won't help, like for a malformed
+	// request.
+	Retryable bool
+	// Attempts is the number of retries made before giving up.
+	Attempts int
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// PermissionDenied returns true if the error was due to missing permissions,
+// like a Vault token without access to the path or an unreadable file.
+func (e *FetchError) PermissionDenied() bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return errors.Is(e.Err, fs.ErrPermission)
+}
@@ -0,0 +1,207 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dep
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// QueryOptions is a list of options to send with the query. These options are
+// client-agnostic, and the dependency determines which, if any, of the options
+// to use.
+type QueryOptions struct {
+	AllowStale        bool
+	Datacenter        string
+	Filter            string
+	Namespace         string
+	Near              string
+	Partition         string
+	Region            string
+	RequireConsistent bool
+	VaultGrace        time.Duration
+	WaitIndex         uint64
+	WaitTime          time.Duration
+	DefaultLease      time.Duration
+	PollingWait       time.Duration
+	// UseStreaming states that the Consul agent streams the queries of the
+	// dependencies that support it (see the agent's use_streaming_backend),
+	// they then leave out the cache options.
+	UseStreaming bool
+	// UseCache asks the Consul agent to serve the query from its cache,
+	// MaxAge and StaleIfError limit how old the cached response can be, the
+	// latter when the servers can't be reached. See the Consul API's
+	// QueryOptions.
+	UseCache     bool
+	MaxAge       time.Duration
+	StaleIfError time.Duration
+
+	ctx context.Context
+}
+
+func (q *QueryOptions) Merge(o *QueryOptions) *QueryOptions {
+	var r QueryOptions
+
+	if q == nil {
+		if o == nil {
+			return &QueryOptions{}
+		}
+		r = *o
+		return &r
+	}
+
+	r = *q
+
+	if o == nil {
+		return &r
+	}
+
+	if o.AllowStale != false {
+		r.AllowStale = o.AllowStale
+	}
+
+	if o.Datacenter != "" {
+		r.Datacenter = o.Datacenter
+	}
+
+	if o.Filter != "" {
+		r.Filter = o.Filter
+	}
+
+	if o.Namespace != "" {
+		r.Namespace = o.Namespace
+	}
+
+	if o.Near != "" {
+		r.Near = o.Near
+	}
+
+	if o.Partition != "" {
+		r.Partition = o.Partition
+	}
+
+	if o.Region != "" {
+		r.Region = o.Region
+	}
+
+	if o.RequireConsistent != false {
+		r.RequireConsistent = o.RequireConsistent
+	}
+
+	if o.WaitIndex != 0 {
+		r.WaitIndex = o.WaitIndex
+	}
+
+	if o.WaitTime != 0 {
+		r.WaitTime = o.WaitTime
+	}
+
+	if o.PollingWait != 0 {
+		r.PollingWait = o.PollingWait
+	}
+
+	if o.UseStreaming != false {
+		r.UseStreaming = o.UseStreaming
+	}
+
+	if o.UseCache != false {
+		r.UseCache = o.UseCache
+	}
+
+	if o.MaxAge != 0 {
+		r.MaxAge = o.MaxAge
+	}
+
+	if o.StaleIfError != 0 {
+		r.StaleIfError = o.StaleIfError
+	}
+
+	return &r
+}
+
+func (q *QueryOptions) SetContext(ctx context.Context) QueryOptions {
+	var q2 QueryOptions
+	if q != nil {
+		q2 = *q
+	}
+	q2.ctx = ctx
+	return q2
+}
+
+// Context returns the context set with SetContext, or nil.
+func (q *QueryOptions) Context() context.Context {
+	return q.ctx
+}
+
+func (q *QueryOptions) ToConsulOpts() *consulapi.QueryOptions {
+	cq := consulapi.QueryOptions{
+		AllowStale:        q.AllowStale,
+		Datacenter:        q.Datacenter,
+		Filter:            q.Filter,
+		Namespace:         q.Namespace,
+		Near:              q.Near,
+		Partition:         q.Partition,
+		RequireConsistent: q.RequireConsistent,
+		WaitIndex:         q.WaitIndex,
+		WaitTime:          q.WaitTime,
+		UseCache:          q.UseCache,
+		MaxAge:            q.MaxAge,
+		StaleIfError:      q.StaleIfError,
+	}
+
+	if q.ctx != nil {
+		return cq.WithContext(q.ctx)
+	}
+	return &cq
+}
+
+func (q *QueryOptions) String() string {
+	u := &url.Values{}
+
+	if q.AllowStale {
+		u.Add("stale", strconv.FormatBool(q.AllowStale))
+	}
+
+	if q.Datacenter != "" {
+		u.Add("dc", q.Datacenter)
+	}
+
+	if q.Filter != "" {
+		u.Add("filter", q.Filter)
+	}
+
+	if q.Namespace != "" {
+		u.Add("ns", q.Namespace)
+	}
+
+	if q.Near != "" {
+		u.Add("near", q.Near)
+	}
+
+	if q.Partition != "" {
+		u.Add("partition", q.Partition)
+	}
+
+	if q.Region != "" {
+		u.Add("region", q.Region)
+	}
+
+	if q.RequireConsistent {
+		u.Add("consistent", strconv.FormatBool(q.RequireConsistent))
+	}
+
+	if q.WaitIndex != 0 {
+		u.Add("index", strconv.FormatUint(q.WaitIndex, 10))
+	}
+
+	if q.WaitTime != 0 {
+		u.Add("wait", q.WaitTime.String())
+	}
+
+	return u.Encode()
+}
@@ -68,6 +68,29 @@ type HealthService struct {
 	Proxy                  *api.AgentServiceConnectProxyConfig
 }
 
+// GatewayService is a service linked to a terminating or ingress gateway.
+type GatewayService struct {
+	Gateway      GatewayServiceName
+	Service      GatewayServiceName
+	GatewayKind  string
+	Port         int
+	Protocol     string
+	Hosts        []string
+	CAFile       string
+	CertFile     string
+	KeyFile      string
+	SNI          string
+	FromWildcard bool
+}
+
+// GatewayServiceName is the name of a service along with its namespace and
+// partition (Consul Enterprise).
+type GatewayServiceName struct {
+	Name      string
+	Namespace string
+	Partition string
+}
+
 // KvValue is here to type the KV return string
 type KvValue string
 
@@ -88,6 +111,41 @@ type KeyPair struct {
 	Session     string
 }
 
+// NomadVarItems are the key/value pairs of a Nomad Variable.
+type NomadVarItems map[string]string
+
+// NomadVarMeta is the metadata of a Nomad Variable, as returned when listing
+// them.
+type NomadVarMeta struct {
+	Namespace   string
+	Path        string
+	CreateIndex uint64
+	ModifyIndex uint64
+	CreateTime  time.Time
+	ModifyTime  time.Time
+}
+
+// NomadService is a service registration in Nomad.
+type NomadService struct {
+	ID         string
+	Name       string
+	Namespace  string
+	NodeID     string
+	Datacenter string
+	JobID      string
+	AllocID    string
+	Tags       ServiceTags
+	Address    string
+	Port       int
+}
+
+// NomadServicesSnippet is a service entry in the Nomad service list.
+type NomadServicesSnippet struct {
+	Name      string
+	Namespace string
+	Tags      ServiceTags
+}
+
 // Secret is the structure returned for every secret within Vault.
 type Secret struct {
 	// The request ID that generated this response
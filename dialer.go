@@ -0,0 +1,163 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// TransportDialer dials the connections of a client's transport, see
+// TransportInput.CustomDialer.
+type TransportDialer = idep.TransportDialer
+
+// defaultEndpointRefresh is how often the SRV record is resolved by default.
+const defaultEndpointRefresh = 30 * time.Second
+
+// EndpointDialerInput configures an EndpointDialer, one of SRV or Endpoints
+// is required.
+type EndpointDialerInput struct {
+	// SRV is the DNS SRV record (eg. "_consul._tcp.example.com") the
+	// endpoints are resolved from, ordered by priority and weight.
+	SRV string
+	// Endpoints are "host:port" addresses dialed in order.
+	Endpoints []string
+	// Refresh is how often the SRV record is resolved again, defaults to 30s.
+	Refresh time.Duration
+	// Resolver resolves the SRV record, defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+	// Dialer dials the endpoints, defaults to a net.Dialer.
+	Dialer TransportDialer
+}
+
+// EndpointDialer is a TransportDialer connecting to one of its endpoints in
+// place of the client's address, which then only names the server (eg. for
+// TLS, see TransportInput.ServerName). It fails over to the next endpoint on
+// connection errors and keeps using the last one that worked. SRV endpoints
+// are resolved again every Refresh, or on the next dial once all failed.
+type EndpointDialer struct {
+	srv      string
+	refresh  time.Duration
+	resolver *net.Resolver
+	dialer   TransportDialer
+
+	mux       sync.Mutex
+	endpoints []string
+	resolved  time.Time
+	next      int
+}
+
+// NewEndpointDialer returns the EndpointDialer for the input.
+func NewEndpointDialer(i EndpointDialerInput) (*EndpointDialer, error) {
+	switch {
+	case i.SRV == "" && len(i.Endpoints) == 0:
+		return nil, fmt.Errorf("endpoint dialer: SRV or endpoints required")
+	case i.SRV != "" && len(i.Endpoints) > 0:
+		return nil, fmt.Errorf("endpoint dialer: SRV and endpoints are " +
+			"mutually exclusive")
+	}
+	d := &EndpointDialer{
+		srv:       i.SRV,
+		refresh:   i.Refresh,
+		resolver:  i.Resolver,
+		dialer:    i.Dialer,
+		endpoints: append([]string(nil), i.Endpoints...),
+	}
+	if d.refresh <= 0 {
+		d.refresh = defaultEndpointRefresh
+	}
+	if d.resolver == nil {
+		d.resolver = net.DefaultResolver
+	}
+	if d.dialer == nil {
+		d.dialer = &net.Dialer{}
+	}
+	return d, nil
+}
+
+// DialContext dials the endpoints in turn, starting with the last one that
+// worked, until one connects. The address is ignored.
+func (d *EndpointDialer) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	endpoints, start, err := d.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k := range endpoints {
+		n := (start + k) % len(endpoints)
+		var conn net.Conn
+		conn, err = d.dialer.DialContext(ctx, network, endpoints[n])
+		if err == nil {
+			d.mux.Lock()
+			d.next = n
+			d.mux.Unlock()
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	// resolve the SRV record again on the next dial
+	d.mux.Lock()
+	d.resolved = time.Time{}
+	d.mux.Unlock()
+	return nil, fmt.Errorf("endpoint dialer: no endpoint reachable: %w", err)
+}
+
+// Endpoints returns the endpoints last resolved (or given).
+func (d *EndpointDialer) Endpoints() []string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return append([]string(nil), d.endpoints...)
+}
+
+// current returns the endpoints and the index of the one to dial first,
+// resolving the SRV record if it's due. A failed resolution keeps the
+// previous endpoints, if any.
+func (d *EndpointDialer) current(ctx context.Context) ([]string, int, error) {
+	d.mux.Lock()
+	due := d.srv != "" && time.Since(d.resolved) >= d.refresh
+	if !due {
+		defer d.mux.Unlock()
+		return d.endpoints, d.next, nil
+	}
+	d.mux.Unlock()
+
+	endpoints, err := d.resolve(ctx)
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.resolved = time.Now()
+	switch {
+	case err == nil:
+		d.endpoints, d.next = endpoints, 0
+	case len(d.endpoints) == 0:
+		return nil, 0, err
+	}
+	return d.endpoints, d.next, nil
+}
+
+func (d *EndpointDialer) resolve(ctx context.Context) ([]string, error) {
+	_, srvs, err := d.resolver.LookupSRV(ctx, "", "", d.srv)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint dialer: resolving %q: %w", d.srv, err)
+	}
+	if len(srvs) == 0 {
+		return nil, fmt.Errorf("endpoint dialer: no %q records", d.srv)
+	}
+	endpoints := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		endpoints = append(endpoints,
+			net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+	return endpoints, nil
+}
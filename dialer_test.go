@@ -0,0 +1,284 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub is a local DNS server answering SRV queries with its ports,
+// targeting localhost.
+type dnsStub struct {
+	conn net.PacketConn
+
+	mux   sync.Mutex
+	ports []uint16
+}
+
+func newDNSStub(t *testing.T, ports ...uint16) *dnsStub {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dnsStub{conn: conn, ports: ports}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *dnsStub) setPorts(ports ...uint16) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.ports = ports
+}
+
+func (s *dnsStub) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var p dnsmessage.Parser
+		header, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+			ID: header.ID, Response: true, Authoritative: true})
+		b.EnableCompression()
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+		if q.Type == dnsmessage.TypeSRV {
+			s.mux.Lock()
+			for i, port := range s.ports {
+				b.SRVResource(dnsmessage.ResourceHeader{
+					Name: q.Name, Type: q.Type, Class: q.Class, TTL: 1,
+				}, dnsmessage.SRVResource{
+					Priority: uint16(i), Weight: 1, Port: port,
+					Target: dnsmessage.MustNewName("localhost."),
+				})
+			}
+			s.mux.Unlock()
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(msg, addr)
+	}
+}
+
+// resolver returns a resolver querying the stub.
+func (s *dnsStub) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+// recordingDialer records the dialed addresses.
+type recordingDialer struct {
+	mux    sync.Mutex
+	dialed []string
+}
+
+func (r *recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	r.mux.Lock()
+	r.dialed = append(r.dialed, address)
+	r.mux.Unlock()
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+func (r *recordingDialer) reset() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	dialed := r.dialed
+	r.dialed = nil
+	return dialed
+}
+
+// localhost returns the SRV endpoint of the port.
+func localhost(port uint16) string {
+	return net.JoinHostPort("localhost", strconv.Itoa(int(port)))
+}
+
+// listeners returns a listening address and the port of a closed one.
+func listeners(t *testing.T) (string, uint16, string, uint16) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	port := func(ln net.Listener) uint16 {
+		return uint16(ln.Addr().(*net.TCPAddr).Port)
+	}
+	return ln.Addr().String(), port(ln), closed.Addr().String(), port(closed)
+}
+
+func TestEndpointDialer(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewEndpointDialer(EndpointDialerInput{}); err == nil {
+			t.Error("expected an error without endpoints")
+		}
+		_, err := NewEndpointDialer(EndpointDialerInput{
+			SRV: "_consul._tcp.example.com", Endpoints: []string{"foo:1"}})
+		if err == nil {
+			t.Error("expected an error with both SRV and endpoints")
+		}
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		up, _, down, _ := listeners(t)
+		rec := &recordingDialer{}
+		d, err := NewEndpointDialer(EndpointDialerInput{
+			Endpoints: []string{down, up}, Dialer: rec})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, exp := range [][]string{{down, up}, {up}} {
+			conn, err := d.DialContext(context.Background(), "tcp", "ignored:80")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+			if dialed := rec.reset(); !reflect.DeepEqual(dialed, exp) {
+				t.Errorf("expected %v dialed, got %v", exp, dialed)
+			}
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		_, _, down, _ := listeners(t)
+		d, _ := NewEndpointDialer(EndpointDialerInput{Endpoints: []string{down}})
+		if _, err := d.DialContext(context.Background(), "tcp", ""); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("srv", func(t *testing.T) {
+		_, upPort, _, downPort := listeners(t)
+		up, down := localhost(upPort), localhost(downPort)
+		dns := newDNSStub(t, downPort, upPort)
+		rec := &recordingDialer{}
+		d, err := NewEndpointDialer(EndpointDialerInput{
+			SRV:      "_consul._tcp.example.com",
+			Resolver: dns.resolver(),
+			Dialer:   rec,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := d.DialContext(context.Background(), "tcp", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if dialed := rec.reset(); !reflect.DeepEqual(dialed, []string{down, up}) {
+			t.Errorf("expected the SRV endpoints by priority, got %v", dialed)
+		}
+
+		// the endpoints are resolved again once they all fail
+		dns.setPorts(upPort)
+		d.mux.Lock()
+		d.endpoints = []string{down}
+		d.next = 0
+		d.mux.Unlock()
+		if _, err := d.DialContext(context.Background(), "tcp", ""); err == nil {
+			t.Fatal("expected the down endpoint to fail")
+		}
+		conn, err = d.DialContext(context.Background(), "tcp", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if eps := d.Endpoints(); !reflect.DeepEqual(eps, []string{up}) {
+			t.Errorf("expected the endpoints resolved again, got %v", eps)
+		}
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		_, upPort, _, _ := listeners(t)
+		_, up2Port, _, _ := listeners(t)
+		up, up2 := localhost(upPort), localhost(up2Port)
+		dns := newDNSStub(t, upPort)
+		d, _ := NewEndpointDialer(EndpointDialerInput{
+			SRV:      "_consul._tcp.example.com",
+			Resolver: dns.resolver(),
+			Refresh:  1,
+		})
+		conn, err := d.DialContext(context.Background(), "tcp", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if eps := d.Endpoints(); !reflect.DeepEqual(eps, []string{up}) {
+			t.Fatalf("bad endpoints: %v", eps)
+		}
+
+		dns.setPorts(up2Port)
+		conn, err = d.DialContext(context.Background(), "tcp", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if eps := d.Endpoints(); !reflect.DeepEqual(eps, []string{up2}) {
+			t.Errorf("expected the endpoints refreshed, got %v", eps)
+		}
+	})
+
+	t.Run("client", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Consul-LastContact", "0")
+				w.Write([]byte(`"127.0.0.1:8300"`))
+			}))
+		defer ts.Close()
+		port := ts.Listener.Addr().(*net.TCPAddr).Port
+
+		dns := newDNSStub(t, uint16(port))
+		d, _ := NewEndpointDialer(EndpointDialerInput{
+			SRV:      "_consul._tcp.example.com",
+			Resolver: dns.resolver(),
+		})
+		clients := NewClientSet()
+		defer clients.Stop()
+		err := clients.AddConsul(ConsulInput{
+			Address:   "consul.example.com:" + strconv.Itoa(port),
+			Transport: TransportInput{CustomDialer: d},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clients.Consul().Status().Leader(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
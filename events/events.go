@@ -48,27 +48,36 @@ type ServerTimeout struct {
 }
 
 // RetryAttempt indicates that a tracked call is being retried.
+// Kind is the dependency kind used to pick the retry policy, Notifier is the
+// template ID that overrode it (empty for the watcher's default).
 type RetryAttempt struct {
 	event
-	Error   error
-	ID      string
-	Attempt int
-	Sleep   time.Duration
+	Error    error
+	ID       string
+	Attempt  int
+	Sleep    time.Duration
+	Kind     string
+	Notifier string
 }
 
 // MaxRetries indicates that the maximum number of retries has been reached
 // (and failed).
 type MaxRetries struct {
 	event
-	ID    string
-	Count int
+	ID       string
+	Count    int
+	Kind     string
+	Notifier string
 }
 
 // NewData indicates that fresh/new data has been retrieved from the service.
+// CacheHit and CacheAge are set when the Consul agent cache served the data.
 type NewData struct {
 	event
-	Data interface{}
-	ID   string
+	Data     interface{}
+	ID       string
+	CacheHit bool
+	CacheAge time.Duration
 }
 
 // StaleData indicates that the service returned stale (possibly old) data.
@@ -82,7 +91,9 @@ type StaleData struct {
 // matches the current data so no change would be triggered.
 type NoNewData struct {
 	event
-	ID string
+	ID       string
+	CacheHit bool
+	CacheAge time.Duration
 }
 
 // TrackStart indicates that a new data point is being tracked.
@@ -97,14 +108,119 @@ type TrackStop struct {
 	ID string
 }
 
-// Not used yet, need an PolllingQuery interface to match on
-// see BlockingQuery for how it should work
+// PollingWait indicates that a dependency that doesn't support blocking
+// queries is waiting before polling again.
 type PollingWait struct {
 	event
 	ID       string
 	Duration time.Duration
 }
 
+// RenderSuppressed indicates that a template's render was held back by its
+// rate limit. It is rendered after Delay, with any changes made meanwhile.
+type RenderSuppressed struct {
+	event
+	ID    string
+	Delay time.Duration
+}
+
+// BufferStart indicates that a change started a template's buffer period.
+// The template is notified after Wait, unless more changes extend it, but no
+// later than Deadline.
+type BufferStart struct {
+	event
+	ID       string
+	Wait     time.Duration
+	Deadline time.Time
+}
+
+// BufferExtend indicates that another change during a template's buffer
+// period pushed it back by Wait.
+type BufferExtend struct {
+	event
+	ID       string
+	Wait     time.Duration
+	Deadline time.Time
+}
+
+// BufferDeadline indicates that a change during a template's buffer period
+// couldn't extend it past its max Deadline.
+type BufferDeadline struct {
+	event
+	ID       string
+	Deadline time.Time
+}
+
+// BufferTrigger indicates that a template's buffer period ended and it is
+// notified of the buffered changes.
+type BufferTrigger struct {
+	event
+	ID string
+}
+
+// QueryQueued indicates that a dependency is waiting for one of the
+// Watcher's query slots. Position is its place in the queue, from 1.
+type QueryQueued struct {
+	event
+	ID       string
+	Position int
+}
+
+// Throttled indicates that the server rate limited a query (HTTP 429). It
+// is retried after Sleep, backing off further on each Attempt.
+type Throttled struct {
+	event
+	Error   error
+	ID      string
+	Attempt int
+	Sleep   time.Duration
+}
+
+// QueryBackend indicates that the Consul backend serving a dependency's
+// queries changed, Backend being "streaming" or "blocking-query". A change
+// to "blocking-query" with ConsulStreaming set means the agent doesn't stream,
+// ie. its use_streaming_backend setting is off.
+type QueryBackend struct {
+	event
+	ID      string
+	Backend string
+}
+
+// Degraded indicates that a dependency's retries are exhausted but its last
+// data, received at LastData, is still served while it keeps retrying.
+type Degraded struct {
+	event
+	Error    error
+	ID       string
+	LastData time.Time
+}
+
+// Recovered indicates that a degraded dependency reached its upstream again
+// after Duration in degraded mode.
+type Recovered struct {
+	event
+	ID       string
+	Duration time.Duration
+}
+
+// CredentialsRotated indicates that a client's credentials were replaced,
+// Client being "consul" or "vault" and Credential "token", "tls" or "login"
+// (a new token from a Consul auth method login).
+type CredentialsRotated struct {
+	event
+	Client     string
+	Credential string
+}
+
+// CredentialsRotationFailed indicates that a client's credentials couldn't
+// be replaced, the client keeps using the previous ones.
+type CredentialsRotationFailed struct {
+	event
+	Error      error
+	Client     string
+	Credential string
+}
+
 // Event interface type fulfillment
 type event struct{}
 
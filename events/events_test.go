@@ -21,6 +21,18 @@ var (
 	_ Event = (*TrackStart)(nil)
 	_ Event = (*TrackStop)(nil)
 	_ Event = (*PollingWait)(nil)
+	_ Event = (*RenderSuppressed)(nil)
+	_ Event = (*BufferStart)(nil)
+	_ Event = (*BufferExtend)(nil)
+	_ Event = (*BufferDeadline)(nil)
+	_ Event = (*BufferTrigger)(nil)
+	_ Event = (*QueryQueued)(nil)
+	_ Event = (*Throttled)(nil)
+	_ Event = (*QueryBackend)(nil)
+	_ Event = (*Degraded)(nil)
+	_ Event = (*Recovered)(nil)
+	_ Event = (*CredentialsRotated)(nil)
+	_ Event = (*CredentialsRotationFailed)(nil)
 )
 
 func TestEvents(t *testing.T) {
@@ -29,7 +41,10 @@ func TestEvents(t *testing.T) {
 		switch e.(type) {
 		case Trace, BlockingWait, ServerContacted, ServerError,
 			ServerTimeout, RetryAttempt, MaxRetries, NewData, StaleData,
-			NoNewData, TrackStart, TrackStop, PollingWait:
+			NoNewData, TrackStart, TrackStop, PollingWait, RenderSuppressed,
+			BufferStart, BufferExtend, BufferDeadline, BufferTrigger,
+			QueryQueued, Throttled, QueryBackend, Degraded, Recovered,
+			CredentialsRotated, CredentialsRotationFailed:
 		default:
 			t.Errorf("Bad event type: %T", e)
 		}
@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// goroutines keeps count of the watcher's running goroutines by name, so
+// Shutdown can wait for them to return and report those that didn't. A nil
+// goroutines doesn't count anything.
+type goroutines struct {
+	mux     sync.Mutex
+	running map[string]int
+	closed  bool
+	idle    chan struct{} // closed when none are running
+}
+
+func newGoroutines() *goroutines {
+	idle := make(chan struct{})
+	close(idle)
+	return &goroutines{running: make(map[string]int), idle: idle}
+}
+
+// start counts a goroutine as running, done must be called when it returns.
+// It returns false once closed, the goroutine must not be started then.
+func (g *goroutines) start(name string) (done func(), ok bool) {
+	if g == nil {
+		return func() {}, true
+	}
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.closed {
+		return nil, false
+	}
+	if len(g.running) == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.running[name]++
+
+	var once sync.Once
+	return func() { once.Do(func() { g.done(name) }) }, true
+}
+
+func (g *goroutines) done(name string) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.running[name]--; g.running[name] <= 0 {
+		delete(g.running, name)
+	}
+	if len(g.running) == 0 {
+		close(g.idle)
+	}
+}
+
+// close keeps new goroutines from starting.
+func (g *goroutines) close() {
+	if g == nil {
+		return
+	}
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.closed = true
+}
+
+// wait blocks until no goroutine is running or the context is done, in which
+// case the error names those still running.
+func (g *goroutines) wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mux.Lock()
+	idle := g.idle
+	g.mux.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if len(g.running) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(g.running))
+	for name, n := range g.running {
+		if n > 1 {
+			name = fmt.Sprintf("%s (x%d)", name, n)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("%w: still running: %s", ctx.Err(),
+		strings.Join(names, ", "))
+}
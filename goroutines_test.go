@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestGoroutines(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		var g *goroutines
+		done, ok := g.start("foo")
+		if !ok {
+			t.Fatal("nil goroutines should always start")
+		}
+		done()
+		g.close()
+		if err := g.wait(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		g := newGoroutines()
+		if err := g.wait(context.Background()); err != nil {
+			t.Fatal("expected no wait without goroutines:", err)
+		}
+
+		done1, _ := g.start("foo")
+		done2, _ := g.start("foo")
+		done3, _ := g.start("bar")
+		done3()
+		done3() // done is idempotent
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := g.wait(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) ||
+			!strings.HasSuffix(err.Error(), "still running: foo (x2)") {
+			t.Fatalf("bad wait error: %v", err)
+		}
+
+		done1()
+		done2()
+		if err := g.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		g := newGoroutines()
+		g.close()
+		if _, ok := g.start("foo"); ok {
+			t.Error("expected no start once closed")
+		}
+	})
+}
+
+// stuckDep's fetch ignores cancellation, blocking until released
+type stuckDep struct {
+	idep.FakeDep
+	fetching chan struct{}
+	release  chan struct{}
+}
+
+func (d *stuckDep) Fetch(c dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	close(d.fetching)
+	<-d.release
+	return d.FakeDep.Fetch(c)
+}
+
+func TestWatcherShutdown(t *testing.T) {
+	t.Run("drained", func(t *testing.T) {
+		w := newWatcher()
+		n := fakeNotifier("foo")
+		w.Register(n)
+		d := &idep.FakeDep{Name: "foo"}
+		w.Recaller(n)(d)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := w.Shutdown(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// no new polling once shut down
+		w.Recaller(n)(d)
+		w.goroutines.mux.Lock()
+		defer w.goroutines.mux.Unlock()
+		if len(w.goroutines.running) != 0 {
+			t.Errorf("expected no goroutines, got %v", w.goroutines.running)
+		}
+	})
+
+	t.Run("outstanding", func(t *testing.T) {
+		w := newWatcher()
+		n := fakeNotifier("foo")
+		w.Register(n)
+		d := &stuckDep{
+			FakeDep:  idep.FakeDep{Name: "foo"},
+			fetching: make(chan struct{}),
+			release:  make(chan struct{}),
+		}
+		w.Recaller(n)(d)
+		<-d.fetching
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := w.Shutdown(ctx)
+		if err == nil || !strings.Contains(err.Error(), "fetch "+d.ID()) {
+			t.Fatalf("expected the stuck fetch to be reported, got %v", err)
+		}
+
+		close(d.release)
+		if err := w.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
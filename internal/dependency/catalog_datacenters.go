@@ -9,12 +9,12 @@ import (
 
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
 	// Ensure implements
 	_ isDependency = (*CatalogDatacentersQuery)(nil)
+	_ PollingQuery = (*CatalogDatacentersQuery)(nil)
 
 	// CatalogDatacentersQuerySleepTime is the amount of time to sleep between
 	// queries, since the endpoint does not support blocking queries.
@@ -40,28 +40,15 @@ func NewCatalogDatacentersQuery(ignoreFailing bool) (*CatalogDatacentersQuery, e
 // Fetch queries the Consul API defined by the given client and returns a slice
 // of strings representing the datacenters
 func (d *CatalogDatacentersQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
-	opts := d.opts.Merge(&QueryOptions{})
-
-	// This is pretty ghetto, but the datacenters endpoint does not support
-	// blocking queries, so we are going to "fake it until we make it". When we
-	// first query, the LastIndex will be "0", meaning we should immediately
-	// return data, but future calls will include a LastIndex. If we have a
-	// LastIndex in the query metadata, sleep for 15 seconds before asking Consul
-	// again.
-	//
-	// This is probably okay given the frequency in which datacenters actually
-	// change, but is technically not edge-triggering.
-	if opts.WaitIndex != 0 {
-		select {
-		case <-d.stopCh:
-			return nil, nil, ErrStopped
-		case <-time.After(CatalogDatacentersQuerySleepTime):
-		}
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
 	}
 
 	result, err := clients.Consul().Catalog().Datacenters()
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	// If the user opted in for skipping "down" datacenters, figure out which
@@ -85,6 +72,17 @@ func (d *CatalogDatacentersQuery) Fetch(clients dep.Clients) (interface{}, *dep.
 	return respWithMetadata(result)
 }
 
+// PollingWait returns the time to wait between queries. The datacenters
+// endpoint does not support blocking queries, so we "fake it until we make
+// it". This is probably okay given the frequency in which datacenters
+// actually change, but is technically not edge-triggering.
+func (d *CatalogDatacentersQuery) PollingWait() time.Duration {
+	if d.opts.PollingWait != 0 {
+		return d.opts.PollingWait
+	}
+	return CatalogDatacentersQuerySleepTime
+}
+
 // CanShare returns if this dependency is shareable.
 func (d *CatalogDatacentersQuery) CanShare() bool {
 	return true
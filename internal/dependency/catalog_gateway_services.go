@@ -0,0 +1,181 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+)
+
+var (
+	// Ensure implements
+	_ isDependency = (*CatalogGatewayServicesQuery)(nil)
+)
+
+func init() {
+	gob.Register([]*dep.GatewayService{})
+}
+
+// CatalogGatewayServicesQuery is the representation of a requested gateway
+// services dependency from inside a template. It returns the services linked
+// to a terminating or ingress gateway.
+type CatalogGatewayServicesQuery struct {
+	isConsul
+	stopCh chan struct{}
+
+	name      string
+	dc        string
+	ns        string
+	partition string
+	opts      QueryOptions
+}
+
+// NewCatalogGatewayServicesQueryV1 processes the gateway name and options in
+// the format of "key=value" e.g. "dc=dc1" to build a gateway services
+// dependency.
+func NewCatalogGatewayServicesQueryV1(gateway string, opts []string) (*CatalogGatewayServicesQuery, error) {
+	if gateway == "" {
+		return nil, fmt.Errorf("catalog.gateway-services: gateway name required")
+	}
+
+	gatewayServicesQuery := CatalogGatewayServicesQuery{
+		stopCh: make(chan struct{}, 1),
+		name:   gateway,
+	}
+
+	for _, opt := range opts {
+		if strings.TrimSpace(opt) == "" {
+			continue
+		}
+
+		query, value, err := stringsSplit2(opt, "=")
+		if err != nil {
+			return nil, fmt.Errorf(
+				"catalog.gateway-services: invalid query parameter format: %q", opt)
+		}
+		switch query {
+		case "dc", "datacenter":
+			gatewayServicesQuery.dc = value
+		case "ns", "namespace":
+			gatewayServicesQuery.ns = value
+		case "partition":
+			gatewayServicesQuery.partition = value
+		default:
+			return nil, fmt.Errorf(
+				"catalog.gateway-services: invalid query parameter: %q", opt)
+		}
+	}
+
+	return &gatewayServicesQuery, nil
+}
+
+// Fetch queries the Consul API defined by the given client and returns a slice
+// of GatewayService objects.
+func (d *CatalogGatewayServicesQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts := d.opts.Merge(&QueryOptions{
+		Datacenter: d.dc,
+		Namespace:  d.ns,
+		Partition:  d.partition,
+	})
+
+	entries, qm, err := clients.Consul().Catalog().GatewayServices(
+		d.name, opts.ToConsulOpts())
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	services := make([]*dep.GatewayService, 0, len(entries))
+	for _, entry := range entries {
+		services = append(services, &dep.GatewayService{
+			Gateway:      gatewayServiceName(entry.Gateway),
+			Service:      gatewayServiceName(entry.Service),
+			GatewayKind:  string(entry.GatewayKind),
+			Port:         entry.Port,
+			Protocol:     entry.Protocol,
+			Hosts:        append([]string{}, entry.Hosts...),
+			CAFile:       entry.CAFile,
+			CertFile:     entry.CertFile,
+			KeyFile:      entry.KeyFile,
+			SNI:          entry.SNI,
+			FromWildcard: entry.FromWildcard,
+		})
+	}
+
+	sort.SliceStable(services,
+		func(i, j int) bool {
+			if services[i].Service.Name < services[j].Service.Name {
+				return true
+			} else if services[i].Service.Name == services[j].Service.Name {
+				return services[i].Port < services[j].Port
+			}
+			return false
+		})
+
+	rm := &dep.ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	return services, rm, nil
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *CatalogGatewayServicesQuery) CanShare() bool {
+	return true
+}
+
+// ID returns the human-friendly version of this dependency.
+func (d *CatalogGatewayServicesQuery) ID() string {
+	name := d.name
+	if d.dc != "" {
+		name = name + "@" + d.dc
+	}
+
+	var opts []string
+	if d.ns != "" {
+		opts = append(opts, fmt.Sprintf("ns=%s", d.ns))
+	}
+	if d.partition != "" {
+		opts = append(opts, fmt.Sprintf("partition=%s", d.partition))
+	}
+	if len(opts) > 0 {
+		name = fmt.Sprintf("%s?%s", name, strings.Join(opts, "&"))
+	}
+	return fmt.Sprintf("catalog.gateway-services(%s)", name)
+}
+
+// Stringer interface reuses ID
+func (d *CatalogGatewayServicesQuery) String() string {
+	return d.ID()
+}
+
+// Stop halts the dependency's fetch function.
+func (d *CatalogGatewayServicesQuery) Stop() {
+	close(d.stopCh)
+}
+
+func (d *CatalogGatewayServicesQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
+
+// gatewayServiceName copies the compound service name returned by Consul into
+// the public type.
+func gatewayServiceName(n api.CompoundServiceName) dep.GatewayServiceName {
+	return dep.GatewayServiceName{
+		Name:      n.Name,
+		Namespace: n.Namespace,
+		Partition: n.Partition,
+	}
+}
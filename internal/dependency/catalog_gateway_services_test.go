@@ -0,0 +1,171 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/hcat/dep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCatalogGatewayServicesQueryV1(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		gateway string
+		opts    []string
+		exp     *CatalogGatewayServicesQuery
+		err     bool
+	}{
+		{
+			"no gateway",
+			"",
+			[]string{},
+			nil,
+			true,
+		},
+		{
+			"no opts",
+			"gateway",
+			[]string{},
+			&CatalogGatewayServicesQuery{
+				name: "gateway",
+			},
+			false,
+		},
+		{
+			"dc",
+			"gateway",
+			[]string{"dc=dc1"},
+			&CatalogGatewayServicesQuery{
+				name: "gateway",
+				dc:   "dc1",
+			},
+			false,
+		},
+		{
+			"ns",
+			"gateway",
+			[]string{"ns=namespace"},
+			&CatalogGatewayServicesQuery{
+				name: "gateway",
+				ns:   "namespace",
+			},
+			false,
+		},
+		{
+			"partition",
+			"gateway",
+			[]string{"partition=part"},
+			&CatalogGatewayServicesQuery{
+				name:      "gateway",
+				partition: "part",
+			},
+			false,
+		},
+		{
+			"multiple",
+			"gateway",
+			[]string{"partition=part", "ns=namespace", "dc=dc1"},
+			&CatalogGatewayServicesQuery{
+				name:      "gateway",
+				dc:        "dc1",
+				ns:        "namespace",
+				partition: "part",
+			},
+			false,
+		},
+		{
+			"invalid query",
+			"gateway",
+			[]string{"invalid=true"},
+			nil,
+			true,
+		},
+		{
+			"invalid query format",
+			"gateway",
+			[]string{"dc1"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewCatalogGatewayServicesQueryV1(tc.gateway, tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.NoError(t, err, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestCatalogGatewayServicesQuery_Fetch(t *testing.T) {
+	t.Parallel()
+
+	d, err := NewCatalogGatewayServicesQueryV1("unknown-gateway", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	act, _, err := d.Fetch(testClients)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []*dep.GatewayService{}, act)
+}
+
+func TestCatalogGatewayServicesQuery_String(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		i    []string
+		exp  string
+	}{
+		{
+			"gateway",
+			[]string{},
+			"catalog.gateway-services(gateway)",
+		},
+		{
+			"datacenter",
+			[]string{"dc=dc1"},
+			"catalog.gateway-services(gateway@dc1)",
+		},
+		{
+			"namespace",
+			[]string{"ns=namespace"},
+			"catalog.gateway-services(gateway?ns=namespace)",
+		},
+		{
+			"multiple",
+			[]string{"partition=part", "dc=dc1", "ns=namespace"},
+			"catalog.gateway-services(gateway@dc1?ns=namespace&partition=part)",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewCatalogGatewayServicesQueryV1("gateway", tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.exp, d.ID())
+		})
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"sort"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -71,13 +70,13 @@ func (d *CatalogNodeQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respons
 		var err error
 		name, err = clients.Consul().Agent().NodeName()
 		if err != nil {
-			return nil, nil, errors.Wrapf(err, d.ID())
+			return nil, nil, fetchError(d, err)
 		}
 	}
 
 	node, qm, err := clients.Consul().Catalog().Node(name, opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	rm := &dep.ResponseMetadata{
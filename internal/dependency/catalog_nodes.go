@@ -10,7 +10,6 @@ import (
 	"sort"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -66,7 +65,7 @@ func (d *CatalogNodesQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respon
 
 	n, qm, err := clients.Consul().Catalog().Nodes(opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	nodes := make([]*dep.Node, 0, len(n))
@@ -10,7 +10,6 @@ import (
 	"regexp"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -97,7 +96,7 @@ func (d *CatalogServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.Resp
 
 	entries, qm, err := clients.Consul().Catalog().Service(d.name, d.tag, opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	var list []*CatalogService
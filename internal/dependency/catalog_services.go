@@ -11,7 +11,6 @@ import (
 	"strings"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -35,6 +34,7 @@ type CatalogServicesQuery struct {
 	dc       string
 	ns       string
 	nodeMeta map[string]string
+	cache    cacheOpts
 	opts     QueryOptions
 }
 
@@ -73,8 +73,15 @@ func NewCatalogServicesQueryV1(opts []string) (*CatalogServicesQuery, error) {
 			}
 			catalogServicesQuery.nodeMeta[k] = v
 		default:
-			return nil, fmt.Errorf(
-				"catalog.services: invalid query parameter: %q", opt)
+			ok, err := catalogServicesQuery.cache.parse(
+				"catalog.services", query, value)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf(
+					"catalog.services: invalid query parameter: %q", opt)
+			}
 		}
 	}
 
@@ -103,17 +110,17 @@ func (d *CatalogServicesQuery) Fetch(clients dep.Clients) (interface{}, *dep.Res
 	default:
 	}
 
-	opts := d.opts.Merge(&QueryOptions{
+	opts := d.cache.merge(d.opts.Merge(&QueryOptions{
 		Datacenter: d.dc,
 		Namespace:  d.ns,
-	}).ToConsulOpts()
+	})).ToConsulOpts()
 	// node-meta is handled specifically for /v1/catalog/services endpoint since
 	// it does not support the preferred filter option.
 	opts.NodeMeta = d.nodeMeta
 
 	entries, qm, err := clients.Consul().Catalog().Services(opts)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	var catalogServices []*dep.CatalogSnippet
@@ -136,6 +143,7 @@ func (d *CatalogServicesQuery) Fetch(clients dep.Clients) (interface{}, *dep.Res
 		LastIndex:   qm.LastIndex,
 		LastContact: qm.LastContact,
 	}
+	cacheMetadata(rm, qm)
 
 	return catalogServices, rm, nil
 }
@@ -157,6 +165,7 @@ func (d *CatalogServicesQuery) ID() string {
 	for k, v := range d.nodeMeta {
 		opts = append(opts, fmt.Sprintf("node-meta=%s:%s", k, v))
 	}
+	opts = append(opts, d.cache.id()...)
 	if len(opts) > 0 {
 		sort.Strings(opts)
 		return fmt.Sprintf("catalog.services(%s)", strings.Join(opts, "&"))
@@ -6,6 +6,7 @@ package dependency
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/hcat/dep"
 	"github.com/stretchr/testify/assert"
@@ -107,6 +108,20 @@ func TestNewCatalogServicesQueryV1(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"cached",
+			[]string{"cached=true", "stale-if-error=10m"},
+			&CatalogServicesQuery{
+				cache: cacheOpts{use: true, set: true, staleIfError: 10 * time.Minute},
+			},
+			false,
+		},
+		{
+			"invalid cached",
+			[]string{"cached=maybe"},
+			nil,
+			true,
+		},
 		{
 			"invalid query",
 			[]string{"invalid=true"},
@@ -0,0 +1,278 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/events"
+)
+
+// SetEventHandler sets the handler sent the credential rotation events.
+func (c *ClientSet) SetEventHandler(handler events.EventHandler) {
+	c.Lock()
+	defer c.Unlock()
+	c.event = handler
+}
+
+// RotateConsulToken replaces the Consul client's ACL token. It is set on
+// every request made from now on, including the retries and the next
+// queries of those in flight. A token sourced from a file or a login
+// replaces it on its next update.
+func (c *ClientSet) RotateConsulToken(token string) error {
+	c.RLock()
+	consul := c.consul
+	c.RUnlock()
+	if consul == nil {
+		return c.rotated("consul", "token",
+			fmt.Errorf("client set: consul: no client"))
+	}
+	consul.token.set(token)
+	return c.rotated("consul", "token", nil)
+}
+
+// RotateVaultToken replaces the Vault client's token, used by every request
+// made from now on.
+func (c *ClientSet) RotateVaultToken(token string) error {
+	c.RLock()
+	vault := c.vault
+	c.RUnlock()
+	if vault == nil {
+		return c.rotated("vault", "token",
+			fmt.Errorf("client set: vault: no client"))
+	}
+	vault.client.SetToken(token)
+	return c.rotated("vault", "token", nil)
+}
+
+// ReloadTLS reloads the client certificates and keys of the Consul and Vault
+// clients from their files. The idle connections are closed, so new ones
+// are made with the reloaded certificate. Clients without a certificate are
+// skipped.
+func (c *ClientSet) ReloadTLS() error {
+	var errs []string
+	for _, tc := range c.tlsClients() {
+		if err := c.reloadTLS(tc); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("client set: reload tls: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// defaultTLSFileInterval is how often the TLS files are polled by default.
+const defaultTLSFileInterval = 10 * time.Second
+
+// WatchTLSFiles polls the client certificate and key files every interval,
+// reloading those that changed (see ReloadTLS). The interval defaults to 10s
+// if it isn't positive. It runs until the set is stopped by its last user
+// (see Stop), calling it again while watching does nothing.
+func (c *ClientSet) WatchTLSFiles(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultTLSFileInterval
+	}
+	c.Lock()
+	if c.watchStop != nil {
+		c.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.watchStop = stop
+	c.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			for _, tc := range c.tlsClients() {
+				if tc.certs.changed() {
+					c.reloadTLS(tc)
+				}
+			}
+		}
+	}()
+}
+
+// tlsClient is a client whose certificate can be reloaded.
+type tlsClient struct {
+	name       string
+	certs      *certReloader
+	httpClient *http.Client
+}
+
+func (c *ClientSet) tlsClients() []tlsClient {
+	c.RLock()
+	defer c.RUnlock()
+	var tcs []tlsClient
+	if c.consul != nil && c.consul.certs != nil {
+		tcs = append(tcs, tlsClient{"consul", c.consul.certs, c.consul.httpClient})
+	}
+	if c.vault != nil && c.vault.certs != nil {
+		tcs = append(tcs, tlsClient{"vault", c.vault.certs, c.vault.httpClient})
+	}
+	return tcs
+}
+
+func (c *ClientSet) reloadTLS(tc tlsClient) error {
+	err := tc.certs.load()
+	if err == nil {
+		tc.httpClient.CloseIdleConnections()
+	} else {
+		err = fmt.Errorf("%s: %s", tc.name, err)
+	}
+	return c.rotated(tc.name, "tls", err)
+}
+
+// rotated sends the rotation's event, returning its error.
+func (c *ClientSet) rotated(client, credential string, err error) error {
+	c.RLock()
+	handler := c.event
+	c.RUnlock()
+	if handler == nil {
+		return err
+	}
+	if err != nil {
+		handler(events.CredentialsRotationFailed{
+			Client: client, Credential: credential, Error: err})
+	} else {
+		handler(events.CredentialsRotated{
+			Client: client, Credential: credential})
+	}
+	return err
+}
+
+// tokenTransport sets the Consul token header on the requests once a token
+// is rotated in, overriding the one the client was created with, unless the
+// request carries its own token (see withRequestToken). Denied requests are
+// signaled on denied, if set.
+type tokenTransport struct {
+	base   http.RoundTripper
+	denied chan struct{}
+
+	mux     sync.RWMutex
+	token   string
+	rotated bool
+}
+
+func newTokenTransport(base http.RoundTripper) *tokenTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tokenTransport{base: base}
+}
+
+func (t *tokenTransport) set(token string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.token, t.rotated = token, true
+}
+
+// requestTokenKey marks a request's context to keep the request's token.
+type requestTokenKey struct{}
+
+// withRequestToken returns write options sending the token on the request,
+// not the one rotated in, eg. to log out of a token no longer in use.
+func withRequestToken(token string) *consulapi.WriteOptions {
+	ctx := context.WithValue(context.Background(), requestTokenKey{}, true)
+	return (&consulapi.WriteOptions{Token: token}).WithContext(ctx)
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mux.RLock()
+	token, rotated := t.token, t.rotated
+	t.mux.RUnlock()
+	if rotated && req.Context().Value(requestTokenKey{}) == nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Consul-Token", token)
+		if token == "" {
+			req.Header.Del("X-Consul-Token")
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusForbidden && t.denied != nil {
+		select {
+		case t.denied <- struct{}{}:
+		default:
+		}
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the base transport's idle connections.
+func (t *tokenTransport) CloseIdleConnections() {
+	type closeIdler interface{ CloseIdleConnections() }
+	if ci, ok := t.base.(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// withTransport returns a copy of the client using the transport.
+func withTransport(client *http.Client, transport http.RoundTripper) *http.Client {
+	c := *client
+	c.Transport = transport
+	return &c
+}
+
+// certReloader holds a client certificate loaded from files, for the TLS
+// handshakes to use the latest loaded.
+type certReloader struct {
+	certFile, keyFile string
+
+	mux   sync.RWMutex
+	cert  *tls.Certificate
+	stamp string
+}
+
+// load (re)loads the certificate and key from their files.
+func (r *certReloader) load() error {
+	stamp := fileStamp(r.certFile, r.keyFile)
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.cert, r.stamp = &cert, stamp
+	return nil
+}
+
+// changed returns true if the files changed since they were last loaded.
+func (r *certReloader) changed() bool {
+	stamp := fileStamp(r.certFile, r.keyFile)
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return stamp != r.stamp
+}
+
+// fileStamp identifies the files' versions by their size and mod time.
+func fileStamp(names ...string) string {
+	var stamp strings.Builder
+	for _, name := range names {
+		if fi, err := os.Stat(name); err == nil {
+			fmt.Fprintf(&stamp, "%d:%d;", fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return stamp.String()
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.cert, nil
+}
@@ -9,11 +9,14 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	consulapi "github.com/hashicorp/consul/api"
 	rootcerts "github.com/hashicorp/go-rootcerts"
+	"github.com/hashicorp/hcat/events"
+	nomadapi "github.com/hashicorp/nomad/api"
 	vaultapi "github.com/hashicorp/vault/api"
 )
 
@@ -24,18 +27,36 @@ type ClientSet struct {
 
 	vault  *vaultClient
 	consul *consulClient
+	named  map[string]*namedClient
+
+	// event is sent the credential rotation events
+	event events.EventHandler
+	// watchStop stops the polling of the TLS files, nil if not watching
+	watchStop chan struct{}
+	// users is the number of users yet to stop the set, see Use
+	users int
 }
 
 // consulClient is a wrapper around a real Consul API client.
 type consulClient struct {
 	client     *consulapi.Client
 	httpClient *http.Client
+	token      *tokenTransport
+	source     *consulToken
+	certs      *certReloader
 }
 
 // vaultClient is a wrapper around a real Vault API client.
 type vaultClient struct {
 	client     *vaultapi.Client
 	httpClient *http.Client
+	certs      *certReloader
+}
+
+// namedClient is a client added by name along with its close hook.
+type namedClient struct {
+	client interface{}
+	close  func()
 }
 
 // TransportDialer is an interface that allows passing a custom dialer function
@@ -50,12 +71,23 @@ type CreateClientInput struct {
 	Address   string
 	Namespace string
 	Token     string
+	// nomad only
+	Region string
 	// vault only
 	UnwrapToken bool
 	// consul only
 	AuthEnabled  bool
 	AuthUsername string
 	AuthPassword string
+	// TokenFile is re-read on change, instead of a static Token
+	TokenFile string
+	// LoginAuthMethod is the ACL auth method to log in with to get the
+	// token, using the LoginBearerToken or the LoginBearerTokenFile's
+	// content (eg. a Kubernetes service account or JWT token).
+	LoginAuthMethod      string
+	LoginBearerToken     string
+	LoginBearerTokenFile string
+	LoginMeta            map[string]string
 	// Transport/TLS
 	SSLEnabled bool
 	SSLVerify  bool
@@ -109,11 +141,17 @@ func (c *ClientSet) CreateConsulClient(i *CreateClientInput) error {
 		}
 	}
 
-	// set/create our HTTP client
-	if client, err := httpClient(i); err != nil {
+	// set/create our HTTP client, its transport setting the token once
+	// rotated
+	client, certs, err := httpClient(i)
+	if err != nil {
+		return err
+	}
+	token := newTokenTransport(client.Transport)
+	consulConfig.HttpClient = withTransport(client, token)
+	source, err := newConsulToken(i, token)
+	if err != nil {
 		return err
-	} else {
-		consulConfig.HttpClient = client
 	}
 
 	// Setup the new transport
@@ -122,22 +160,35 @@ func (c *ClientSet) CreateConsulClient(i *CreateClientInput) error {
 	}
 
 	// Create the API client
-	client, err := consulapi.NewClient(consulConfig)
+	consul, err := consulapi.NewClient(consulConfig)
 	if err != nil {
 		return fmt.Errorf("client set: consul: %s", err)
 	}
 
-	if err := hasLeader(client, time.Minute); err != nil {
+	if err := hasLeader(consul, time.Minute); err != nil {
 		return err
 	}
 
-	// Save the data on ourselves
+	if source != nil {
+		if err := source.start(c, consul); err != nil {
+			return err
+		}
+	}
+
+	// Save the data on ourselves, stopping the replaced client's token source
 	c.Lock()
+	replaced := c.consul
 	c.consul = &consulClient{
-		client:     client,
+		client:     consul,
 		httpClient: consulConfig.HttpClient,
+		token:      token,
+		source:     source,
+		certs:      certs,
 	}
 	c.Unlock()
+	if replaced != nil && replaced.source != nil {
+		replaced.source.stop()
+	}
 
 	return nil
 }
@@ -165,6 +216,68 @@ func hasLeader(client *consulapi.Client, maxRetryWait time.Duration) error {
 	}
 }
 
+// NomadClientName is the name the Nomad client is added to the set under.
+const NomadClientName = "nomad"
+
+// CreateNomadClient creates a new Nomad API client from the given input and
+// adds it to the set as the NomadClientName named client, replacing (and
+// closing) the previous one.
+func (c *ClientSet) CreateNomadClient(i *CreateClientInput) error {
+	nomadConfig := nomadapi.DefaultConfig()
+
+	if i.Address != "" {
+		nomadConfig.Address = i.Address
+	}
+
+	if i.SSLEnabled {
+		nomadConfig.Address = "https://" + strings.TrimPrefix(
+			strings.TrimPrefix(nomadConfig.Address, "http://"), "https://")
+	}
+
+	if i.Namespace != "" {
+		nomadConfig.Namespace = i.Namespace
+	}
+
+	if i.Region != "" {
+		nomadConfig.Region = i.Region
+	}
+
+	if i.Token != "" {
+		nomadConfig.SecretID = i.Token
+	}
+
+	// set/create our HTTP client
+	if client, _, err := httpClient(i); err != nil {
+		return err
+	} else {
+		nomadConfig.HttpClient = client
+	}
+
+	// Create the API client
+	client, err := nomadapi.NewClient(nomadConfig)
+	if err != nil {
+		return fmt.Errorf("client set: nomad: %s", err)
+	}
+
+	// Save the data on ourselves, closing the replaced client after
+	// unlocking so its close hook can use the ClientSet
+	c.Lock()
+	if c.named == nil {
+		c.named = make(map[string]*namedClient)
+	}
+	replaced := c.named[NomadClientName]
+	c.named[NomadClientName] = &namedClient{
+		client: client,
+		close:  nomadConfig.HttpClient.CloseIdleConnections,
+	}
+	c.Unlock()
+	if replaced != nil && replaced.close != nil {
+		replaced.close()
+	}
+
+	return nil
+}
+
 func (c *ClientSet) CreateVaultClient(i *CreateClientInput) error {
 	vaultConfig := vaultapi.DefaultConfig()
 
@@ -173,11 +286,11 @@ func (c *ClientSet) CreateVaultClient(i *CreateClientInput) error {
 	}
 
 	// set/create our HTTP client
-	if client, err := httpClient(i); err != nil {
+	hc, certs, err := httpClient(i)
+	if err != nil {
 		return err
-	} else {
-		vaultConfig.HttpClient = client
 	}
+	vaultConfig.HttpClient = hc
 
 	// Create the client
 	client, err := vaultapi.NewClient(vaultConfig)
@@ -222,6 +335,7 @@ func (c *ClientSet) CreateVaultClient(i *CreateClientInput) error {
 	c.vault = &vaultClient{
 		client:     client,
 		httpClient: vaultConfig.HttpClient,
+		certs:      certs,
 	}
 	c.Unlock()
 
@@ -248,11 +362,54 @@ func (c *ClientSet) Vault() *vaultapi.Client {
 	return c.vault.client
 }
 
-// Stop closes all idle connections for any attached clients.
-func (c *ClientSet) Stop() {
+// AddClient adds a client with the given name to the set. The close function
+// is optional and is called when the set is stopped by its last user.
+func (c *ClientSet) AddClient(name string, client interface{}, closeFn func()) error {
+	if name == "" {
+		return fmt.Errorf("client name required")
+	}
+	if client == nil {
+		return fmt.Errorf("client %q is nil", name)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.named[name]; ok {
+		return fmt.Errorf("client %q already exists", name)
+	}
+	if c.named == nil {
+		c.named = make(map[string]*namedClient)
+	}
+	c.named[name] = &namedClient{client: client, close: closeFn}
+	return nil
+}
+
+// Client returns the client with the given name.
+func (c *ClientSet) Client(name string) (interface{}, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	nc, ok := c.named[name]
+	if !ok {
+		return nil, false
+	}
+	return nc.client, true
+}
+
+// Use registers a user of the set, eg. a Watcher, which calls Stop once done
+// with it. The set is only released by the last user's Stop.
+func (c *ClientSet) Use() {
 	c.Lock()
 	defer c.Unlock()
+	c.users++
+}
 
+// Stop closes all idle connections for any attached clients. Unless other
+// users of the set (see Use) have yet to stop it, it also stops watching the
+// TLS files and updating the Consul token, logging out if it was logged in
+// with an auth method, and closes (and removes) the named clients.
+func (c *ClientSet) Stop() {
+	c.Lock()
 	switch {
 	case c.consul == nil:
 	case c.consul.httpClient == nil:
@@ -266,24 +423,54 @@ func (c *ClientSet) Stop() {
 	default:
 		c.vault.httpClient.CloseIdleConnections()
 	}
+
+	if c.users > 1 {
+		c.users--
+		c.Unlock()
+		return
+	}
+	c.users = 0
+	named := c.named
+	c.named = nil
+	if c.watchStop != nil {
+		close(c.watchStop)
+		c.watchStop = nil
+	}
+	var source *consulToken
+	if c.consul != nil {
+		source = c.consul.source
+	}
+	c.Unlock()
+
+	// The token source logs out and the named clients' close hooks are
+	// called after unlocking, so they can use the ClientSet without
+	// deadlocking.
+	if source != nil {
+		source.stop()
+	}
+	for _, nc := range named {
+		if nc.close != nil {
+			nc.close()
+		}
+	}
 }
 
 // httpClient returns the http.Client to use with the API client.
 // Returns the test one if given, otherwise creates one with default transport.
-func httpClient(i *CreateClientInput) (client *http.Client, err error) {
+// The certReloader is nil unless the transport uses a client certificate.
+func httpClient(i *CreateClientInput) (*http.Client, *certReloader, error) {
 	if i.HttpClient != nil {
-		return i.HttpClient, nil
+		return i.HttpClient, nil, nil
 	}
-	var transport *http.Transport
-	if transport, err = newTransport(i); err == nil {
-		client = &http.Client{
-			Transport: transport,
-		}
+	transport, certs, err := newTransport(i)
+	if err != nil {
+		return nil, nil, err
 	}
-	return client, err
+	return &http.Client{Transport: transport}, certs, nil
 }
 
-func newTransport(i *CreateClientInput) (*http.Transport, error) {
+func newTransport(i *CreateClientInput) (*http.Transport, *certReloader, error) {
+	var certs *certReloader
 	// This transport will attempt to keep connections open to the server.
 	transport := &http.Transport{
 		Proxy:               http.ProxyFromEnvironment,
@@ -301,19 +488,19 @@ func newTransport(i *CreateClientInput) (*http.Transport, error) {
 
 		var tlsConfig tls.Config
 
-		// Custom certificate or certificate and key
-		if i.SSLCert != "" && i.SSLKey != "" {
-			cert, err := tls.LoadX509KeyPair(i.SSLCert, i.SSLKey)
-			if err != nil {
-				return nil, fmt.Errorf("client set: ssl: %s", err)
+		// Custom certificate or certificate and key, the key defaulting to
+		// the certificate file. It is reloadable so handshakes use the
+		// latest.
+		if i.SSLCert != "" {
+			keyFile := i.SSLKey
+			if keyFile == "" {
+				keyFile = i.SSLCert
 			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-		} else if i.SSLCert != "" {
-			cert, err := tls.LoadX509KeyPair(i.SSLCert, i.SSLCert)
-			if err != nil {
-				return nil, fmt.Errorf("client set: ssl: %s", err)
+			certs = &certReloader{certFile: i.SSLCert, keyFile: keyFile}
+			if err := certs.load(); err != nil {
+				return nil, nil, fmt.Errorf("client set: ssl: %s", err)
 			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
+			tlsConfig.GetClientCertificate = certs.getClientCertificate
 		}
 
 		// Custom CA certificate
@@ -323,7 +510,7 @@ func newTransport(i *CreateClientInput) (*http.Transport, error) {
 				CAPath: i.SSLCAPath,
 			}
 			if err := rootcerts.ConfigureTLS(&tlsConfig, rootConfig); err != nil {
-				return nil, fmt.Errorf("client set: configuring TLS failed: %s", err)
+				return nil, nil, fmt.Errorf("client set: configuring TLS failed: %s", err)
 			}
 		}
 
@@ -342,7 +529,7 @@ func newTransport(i *CreateClientInput) (*http.Transport, error) {
 		// Save the TLS config on our transport
 		transport.TLSClientConfig = &tlsConfig
 	}
-	return transport, nil
+	return transport, certs, nil
 }
 
 func newDialer(i *CreateClientInput) TransportDialer {
@@ -4,12 +4,27 @@
 package dependency
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	capi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/events"
 	vapi "github.com/hashicorp/vault/api"
 )
 
@@ -109,3 +124,430 @@ func TestClientSet_hasLeader(t *testing.T) {
 		}
 	})
 }
+
+// fakeConsul serves the leader status, passing each request to the handler.
+func fakeConsul(handler func(r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(r)
+		w.Header().Set("X-Consul-LastContact", "0")
+		w.Write([]byte(`"127.0.0.1:8300"`))
+	})
+}
+
+func TestClientSet_RotateConsulToken(t *testing.T) {
+	var mux sync.Mutex
+	var tokens []string
+	ts := httptest.NewServer(fakeConsul(func(r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		tokens = append(tokens, r.Header.Get("X-Consul-Token"))
+	}))
+	defer ts.Close()
+
+	clients := NewClientSet()
+	var got []events.Event
+	clients.SetEventHandler(func(e events.Event) { got = append(got, e) })
+	if err := clients.CreateConsulClient(&CreateClientInput{
+		Address: ts.URL,
+		Token:   "old",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	consul := clients.Consul()
+
+	if err := clients.RotateConsulToken("new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consul.Status().Leader(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if len(tokens) != 2 || tokens[0] != "old" || tokens[1] != "new" {
+		t.Errorf("bad tokens: %v", tokens)
+	}
+	exp := events.CredentialsRotated{Client: "consul", Credential: "token"}
+	if len(got) != 1 || got[0] != exp {
+		t.Errorf("bad events: %#v", got)
+	}
+}
+
+func TestClientSet_RotateVaultToken(t *testing.T) {
+	clients := NewClientSet()
+	var got []events.Event
+	clients.SetEventHandler(func(e events.Event) { got = append(got, e) })
+	if err := clients.RotateVaultToken("new"); err == nil {
+		t.Fatal("expected an error without a vault client")
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected an event, got %#v", got)
+	}
+	if e, ok := got[0].(events.CredentialsRotationFailed); !ok ||
+		e.Client != "vault" || e.Credential != "token" {
+		t.Errorf("bad event: %#v", got[0])
+	}
+
+	if err := clients.CreateVaultClient(&CreateClientInput{
+		Token: "old",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := clients.RotateVaultToken("new"); err != nil {
+		t.Fatal(err)
+	}
+	if token := clients.Vault().Token(); token != "new" {
+		t.Errorf("bad token: %q", token)
+	}
+}
+
+// writeCert writes a self-signed client certificate and its key, the
+// certificate's common name being cn.
+func writeCert(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(certFile, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientSet_ReloadTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	writeCert(t, certFile, keyFile, "one")
+
+	names := make(chan string, 10)
+	ts := httptest.NewUnstartedServer(fakeConsul(func(r *http.Request) {
+		names <- r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	newClients := func(t *testing.T) (*ClientSet, chan events.Event) {
+		clients := NewClientSet()
+		got := make(chan events.Event, 10)
+		clients.SetEventHandler(func(e events.Event) { got <- e })
+		if err := clients.CreateConsulClient(&CreateClientInput{
+			Address:    strings.TrimPrefix(ts.URL, "https://"),
+			SSLEnabled: true,
+			SSLCert:    certFile,
+			SSLKey:     keyFile,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if name := <-names; name != "one" {
+			t.Fatalf("bad certificate: %q", name)
+		}
+		return clients, got
+	}
+	exp := events.CredentialsRotated{Client: "consul", Credential: "tls"}
+
+	t.Run("reload", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, "one")
+		clients, got := newClients(t)
+		defer clients.Stop()
+
+		writeCert(t, certFile, keyFile, "two")
+		if err := clients.ReloadTLS(); err != nil {
+			t.Fatal(err)
+		}
+		if e := <-got; e != exp {
+			t.Errorf("bad event: %#v", e)
+		}
+		if _, err := clients.Consul().Status().Leader(); err != nil {
+			t.Fatal(err)
+		}
+		if name := <-names; name != "two" {
+			t.Errorf("expected the reloaded certificate, got %q", name)
+		}
+
+		os.WriteFile(keyFile, []byte("bad"), 0600)
+		if err := clients.ReloadTLS(); err == nil {
+			t.Error("expected a reload error")
+		}
+		if e, ok := (<-got).(events.CredentialsRotationFailed); !ok ||
+			e.Client != "consul" {
+			t.Errorf("bad event: %#v", e)
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, "one")
+		clients, got := newClients(t)
+		clients.WatchTLSFiles(10 * time.Millisecond)
+		// a Watcher stopping the shared set keeps it watching
+		clients.Use()
+		clients.Use()
+		defer clients.Stop()
+		clients.Stop()
+
+		// change the size so the change is seen despite the mod time's
+		// resolution
+		writeCert(t, certFile, keyFile, "three")
+		select {
+		case e := <-got:
+			if e != exp {
+				t.Fatalf("bad event: %#v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the files to be reloaded")
+		}
+		if _, err := clients.Consul().Status().Leader(); err != nil {
+			t.Fatal(err)
+		}
+		if name := <-names; name != "three" {
+			t.Errorf("expected the reloaded certificate, got %q", name)
+		}
+	})
+
+	t.Run("default interval", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, "one")
+		clients, _ := newClients(t)
+		clients.WatchTLSFiles(0)
+		clients.RLock()
+		watching := clients.watchStop != nil
+		clients.RUnlock()
+		if !watching {
+			t.Fatal("expected the files to be watched")
+		}
+		clients.Stop()
+		if clients.watchStop != nil {
+			t.Error("expected the watch stopped on stop")
+		}
+	})
+}
+
+func TestClientSet_consulTokenFile(t *testing.T) {
+	defer func(d time.Duration) { tokenFileInterval = d }(tokenFileInterval)
+	tokenFileInterval = 10 * time.Millisecond
+
+	tokens := make(chan string, 10)
+	ts := httptest.NewServer(fakeConsul(func(r *http.Request) {
+		tokens <- r.Header.Get("X-Consul-Token")
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("one\n"), 0600)
+
+	clients := NewClientSet()
+	got := make(chan events.Event, 10)
+	clients.SetEventHandler(func(e events.Event) { got <- e })
+	if err := clients.CreateConsulClient(&CreateClientInput{
+		Address:   ts.URL,
+		TokenFile: tokenFile,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer clients.Stop()
+	<-tokens // leader check
+
+	clients.Consul().Status().Leader()
+	if token := <-tokens; token != "one" {
+		t.Errorf("bad token: %q", token)
+	}
+
+	os.WriteFile(tokenFile, []byte("three\n"), 0600)
+	select {
+	case e := <-got:
+		exp := events.CredentialsRotated{Client: "consul", Credential: "token"}
+		if e != exp {
+			t.Fatalf("bad event: %#v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the token file to be re-read")
+	}
+	clients.Consul().Status().Leader()
+	if token := <-tokens; token != "three" {
+		t.Errorf("bad token: %q", token)
+	}
+}
+
+// fakeACL is a fake Consul server for the ACL login tests. Its tokens expire
+// after ttl, if set, and can be revoked.
+type fakeACL struct {
+	mux        sync.Mutex
+	ttl        time.Duration
+	bearers    []string
+	logins     int
+	revoked    map[string]bool
+	loggedOut  []string
+	lastSecret string
+}
+
+func (f *fakeACL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	token := r.Header.Get("X-Consul-Token")
+	switch r.URL.Path {
+	case "/v1/status/leader":
+		w.Write([]byte(`"127.0.0.1:8300"`))
+	case "/v1/acl/login":
+		var params capi.ACLLoginParams
+		json.NewDecoder(r.Body).Decode(&params)
+		f.bearers = append(f.bearers, params.BearerToken)
+		f.logins++
+		f.lastSecret = fmt.Sprintf("secret%d", f.logins)
+		resp := capi.ACLToken{SecretID: f.lastSecret}
+		if f.ttl > 0 {
+			exp := time.Now().Add(f.ttl)
+			resp.ExpirationTime = &exp
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "/v1/acl/logout":
+		f.loggedOut = append(f.loggedOut, token)
+		f.revoked[token] = true
+		w.Write([]byte("true"))
+	default:
+		if f.revoked[token] {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("ACL not found"))
+			return
+		}
+		w.Header().Set("X-Consul-Index", "1")
+		w.Write([]byte("[]"))
+	}
+}
+
+func (f *fakeACL) secret() string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.lastSecret
+}
+
+func TestClientSet_consulLogin(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		for _, i := range []*CreateClientInput{
+			{TokenFile: "token", LoginAuthMethod: "k8s", LoginBearerToken: "jwt"},
+			{LoginAuthMethod: "k8s"},
+		} {
+			if err := NewClientSet().CreateConsulClient(i); err == nil {
+				t.Errorf("expected an error for %+v", i)
+			}
+		}
+	})
+
+	defer func(d time.Duration) { loginRetryMin = d }(loginRetryMin)
+	loginRetryMin = 10 * time.Millisecond
+
+	fake := &fakeACL{ttl: 200 * time.Millisecond, revoked: map[string]bool{}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	bearerFile := filepath.Join(t.TempDir(), "jwt")
+	os.WriteFile(bearerFile, []byte("jwt1\n"), 0600)
+
+	clients := NewClientSet()
+	got := make(chan events.Event, 10)
+	clients.SetEventHandler(func(e events.Event) { got <- e })
+	if err := clients.CreateConsulClient(&CreateClientInput{
+		Address:              ts.URL,
+		LoginAuthMethod:      "k8s",
+		LoginBearerTokenFile: bearerFile,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if secret := fake.secret(); secret != "secret1" {
+		t.Fatalf("expected a login, got %q", secret)
+	}
+
+	relogin := func(t *testing.T) {
+		t.Helper()
+		select {
+		case e := <-got:
+			exp := events.CredentialsRotated{Client: "consul", Credential: "login"}
+			if e != exp {
+				t.Fatalf("bad event: %#v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected a re-login")
+		}
+	}
+
+	t.Run("expiry", func(t *testing.T) {
+		fake.mux.Lock()
+		fake.ttl = 0
+		fake.mux.Unlock()
+		os.WriteFile(bearerFile, []byte("jwt2\n"), 0600)
+
+		relogin(t)
+		fake.mux.Lock()
+		defer fake.mux.Unlock()
+		if fake.lastSecret != "secret2" ||
+			fmt.Sprint(fake.bearers) != "[jwt1 jwt2]" {
+			t.Errorf("bad logins: %s %v", fake.lastSecret, fake.bearers)
+		}
+		if fmt.Sprint(fake.loggedOut) != "[secret1]" {
+			t.Errorf("expected the expired token to be logged out: %v",
+				fake.loggedOut)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		fake.mux.Lock()
+		fake.revoked["secret2"] = true
+		fake.mux.Unlock()
+
+		if _, _, err := clients.Consul().KV().Get("foo", nil); err == nil {
+			t.Fatal("expected the revoked token to be denied")
+		}
+		relogin(t)
+		if secret := fake.secret(); secret != "secret3" {
+			t.Errorf("expected a login, got %q", secret)
+		}
+		if _, _, err := clients.Consul().KV().Get("foo", nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		// a Watcher stopping the shared set keeps the token
+		clients.Use()
+		clients.Use()
+		clients.Stop()
+		if _, _, err := clients.Consul().KV().Get("foo", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// the logged in token is logged out, not the one rotated in
+		if err := clients.RotateConsulToken("caller"); err != nil {
+			t.Fatal(err)
+		}
+		clients.Stop()
+		fake.mux.Lock()
+		defer fake.mux.Unlock()
+		if n := len(fake.loggedOut); n == 0 || fake.loggedOut[n-1] != "secret3" {
+			t.Errorf("expected a logout on the last stop: %v", fake.loggedOut)
+		}
+		for _, token := range fake.loggedOut {
+			if token == "caller" {
+				t.Errorf("logged out the rotated in token: %v", fake.loggedOut)
+			}
+		}
+	})
+}
@@ -5,7 +5,6 @@ package dependency
 
 import (
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -40,7 +39,7 @@ func (d *ConnectCAQuery) Fetch(clients dep.Clients) (
 	certs, md, err := clients.Consul().Agent().ConnectCARoots(
 		opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	rm := &dep.ResponseMetadata{
@@ -7,7 +7,6 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -45,7 +44,7 @@ func (d *ConnectLeafQuery) Fetch(clients dep.Clients) (
 	cert, md, err := clients.Consul().Agent().ConnectCALeaf(d.service,
 		opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	rm := &dep.ResponseMetadata{
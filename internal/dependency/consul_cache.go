@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+)
+
+// cacheOpts are the Consul agent cache options of the dependencies whose
+// endpoints the agent caches. They are set per template call with
+// "cached=true", "max-age=<duration>" and "stale-if-error=<duration>", the
+// durations implying "cached=true". An explicit "cached=false" turns the cache
+// off, whatever the watcher's options.
+type cacheOpts struct {
+	// set is true once "cached" is given
+	use, set     bool
+	maxAge       time.Duration
+	staleIfError time.Duration
+}
+
+// parse sets the option named by query. It returns false if query isn't a
+// cache option.
+func (c *cacheOpts) parse(prefix, query, value string) (bool, error) {
+	switch query {
+	case "cached":
+		use, err := strconv.ParseBool(value)
+		if err != nil {
+			return true, fmt.Errorf("%s: invalid value for %q: %q",
+				prefix, query, value)
+		}
+		c.use, c.set = use, true
+	case "max-age", "stale-if-error":
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return true, fmt.Errorf("%s: invalid duration for %q: %q",
+				prefix, query, value)
+		}
+		if query == "max-age" {
+			c.maxAge = d
+		} else {
+			c.staleIfError = d
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// merge returns the options with the cache options set, they take precedence
+// over the watcher's.
+func (c cacheOpts) merge(q *QueryOptions) *QueryOptions {
+	r := *q
+	switch {
+	case c.set && !c.use:
+		r.UseCache, r.MaxAge, r.StaleIfError = false, 0, 0
+	case c.enabled():
+		r.UseCache = true
+		if c.maxAge != 0 {
+			r.MaxAge = c.maxAge
+		}
+		if c.staleIfError != 0 {
+			r.StaleIfError = c.staleIfError
+		}
+	}
+	return &r
+}
+
+// enabled returns true if the options ask for the cache.
+func (c cacheOpts) enabled() bool {
+	if c.set {
+		return c.use
+	}
+	return c.maxAge != 0 || c.staleIfError != 0
+}
+
+// id returns the options as query parameters for a dependency ID.
+func (c cacheOpts) id() []string {
+	var opts []string
+	switch {
+	case c.enabled():
+		opts = append(opts, "cached=true")
+	case c.set:
+		opts = append(opts, "cached=false")
+	}
+	if c.maxAge != 0 {
+		opts = append(opts, fmt.Sprintf("max-age=%s", c.maxAge))
+	}
+	if c.staleIfError != 0 {
+		opts = append(opts, fmt.Sprintf("stale-if-error=%s", c.staleIfError))
+	}
+	return opts
+}
+
+// cacheMetadata sets the agent cache hit and age from the query metadata.
+func cacheMetadata(rm *dep.ResponseMetadata, qm *consulapi.QueryMeta) {
+	if qm == nil {
+		return
+	}
+	rm.CacheHit = qm.CacheHit
+	rm.CacheAge = qm.CacheAge
+}
@@ -0,0 +1,224 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+var (
+	// tokenFileInterval is how often the token file is checked for changes.
+	tokenFileInterval = time.Second
+	// loginRetryMin and loginRetryMax bound the wait between failed logins.
+	loginRetryMin = time.Second
+	loginRetryMax = time.Minute
+)
+
+// consulToken keeps the Consul client's token up to date. It re-reads the
+// token file when it changes, or logs in again with the ACL auth method
+// before the token expires and when it is no longer found.
+type consulToken struct {
+	clients *ClientSet
+	client  *consulapi.Client
+	token   *tokenTransport
+
+	file      string
+	fileStamp string
+
+	login      *consulapi.ACLLoginParams
+	bearerFile string
+	// secret is the logged in token, refreshAt when to log in again
+	secret    string
+	refreshAt time.Time
+	retryWait time.Duration
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	doneCh   chan struct{}
+}
+
+// newConsulToken returns the token source set by the input, nil if it only
+// uses a static token.
+func newConsulToken(i *CreateClientInput, token *tokenTransport) (*consulToken, error) {
+	login := i.LoginAuthMethod != ""
+	switch {
+	case i.TokenFile == "" && !login:
+		return nil, nil
+	case i.TokenFile != "" && login:
+		return nil, fmt.Errorf("client set: consul: token file and login " +
+			"are mutually exclusive")
+	case login && i.LoginBearerToken == "" && i.LoginBearerTokenFile == "":
+		return nil, fmt.Errorf("client set: consul: login requires a " +
+			"bearer token or bearer token file")
+	}
+
+	t := &consulToken{
+		token:     token,
+		file:      i.TokenFile,
+		retryWait: loginRetryMin,
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	if login {
+		t.login = &consulapi.ACLLoginParams{
+			AuthMethod:  i.LoginAuthMethod,
+			BearerToken: i.LoginBearerToken,
+			Meta:        i.LoginMeta,
+		}
+		t.bearerFile = i.LoginBearerTokenFile
+		token.denied = make(chan struct{}, 1)
+	}
+	return t, nil
+}
+
+// start gets the first token then keeps it up to date until stopped.
+func (t *consulToken) start(clients *ClientSet, client *consulapi.Client) error {
+	t.clients, t.client = clients, client
+	var err error
+	if t.login != nil {
+		err = t.doLogin()
+	} else {
+		err = t.readFile()
+	}
+	if err != nil {
+		return fmt.Errorf("client set: consul: %s", err)
+	}
+	go t.run()
+	return nil
+}
+
+func (t *consulToken) run() {
+	defer close(t.doneCh)
+
+	var tick <-chan time.Time
+	if t.login == nil {
+		ticker := time.NewTicker(tokenFileInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var timer *time.Timer
+		var refresh <-chan time.Time
+		if !t.refreshAt.IsZero() {
+			timer = time.NewTimer(time.Until(t.refreshAt))
+			refresh = timer.C
+		}
+
+		select {
+		case <-t.stopCh:
+		case <-tick:
+			if t.fileChanged() {
+				t.clients.rotated("consul", "token", t.readFile())
+			}
+		case <-t.token.denied:
+			t.checkLogin()
+		case <-refresh:
+			t.relogin()
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-t.stopCh:
+			return
+		default:
+		}
+	}
+}
+
+// stop stops updating the token, logging out of the auth method.
+func (t *consulToken) stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+		<-t.doneCh
+		if t.secret != "" {
+			t.client.ACL().Logout(withRequestToken(t.secret))
+		}
+	})
+}
+
+// readFile sets the token to the file's content.
+func (t *consulToken) readFile() error {
+	// a failed read is retried on the next change
+	t.fileStamp = fileStamp(t.file)
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		return err
+	}
+	t.token.set(strings.TrimSpace(string(data)))
+	return nil
+}
+
+func (t *consulToken) fileChanged() bool {
+	return fileStamp(t.file) != t.fileStamp
+}
+
+// doLogin logs in with the auth method, logging out of the previous token.
+func (t *consulToken) doLogin() error {
+	params := *t.login
+	if t.bearerFile != "" {
+		data, err := os.ReadFile(t.bearerFile)
+		if err != nil {
+			return err
+		}
+		params.BearerToken = strings.TrimSpace(string(data))
+	}
+
+	token, _, err := t.client.ACL().Login(&params, nil)
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	if t.secret != "" {
+		// the previous token may be gone already, or rotated out
+		t.client.ACL().Logout(withRequestToken(t.secret))
+	}
+	t.token.set(token.SecretID)
+	t.secret = token.SecretID
+
+	// log in again after 3/4 of the token's lifetime
+	t.refreshAt = time.Time{}
+	if token.ExpirationTime != nil {
+		t.refreshAt = time.Now().Add(time.Until(*token.ExpirationTime) * 3 / 4)
+	}
+	return nil
+}
+
+// relogin logs in again, retrying with a backoff on failure.
+func (t *consulToken) relogin() {
+	err := t.doLogin()
+	if err != nil {
+		t.refreshAt = time.Now().Add(t.retryWait)
+		if t.retryWait *= 2; t.retryWait > loginRetryMax {
+			t.retryWait = loginRetryMax
+		}
+	} else {
+		t.retryWait = loginRetryMin
+	}
+	t.clients.rotated("consul", "login", err)
+}
+
+// checkLogin logs in again if a request was denied as the token is gone, ie.
+// expired or deleted.
+func (t *consulToken) checkLogin() {
+	_, _, err := t.client.ACL().TokenReadSelf(nil)
+	// the check's denial is no news
+	select {
+	case <-t.token.denied:
+	default:
+	}
+	var serr consulapi.StatusError
+	if errors.As(err, &serr) && serr.Code == http.StatusForbidden {
+		t.relogin()
+	}
+}
@@ -3,14 +3,105 @@
 
 package dependency
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
 
-// ErrStopped is a special error that is returned when a dependency is
-// prematurely stopped, usually due to a configuration reload or a process
-// interrupt.
-var ErrStopped = errors.New("dependency stopped")
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+	nomadapi "github.com/hashicorp/nomad/api"
+	vaultapi "github.com/hashicorp/vault/api"
+	pkgerrors "github.com/pkg/errors"
+)
 
-// ErrContinue is a special error which says to continue (retry) on error.
-var ErrContinue = errors.New("dependency continue")
+// Aliases of the dep package's errors, so errors.Is matches them whether the
+// dependency is built-in or not (see dep.ErrStopped).
+var (
+	ErrStopped      = dep.ErrStopped
+	ErrContinue     = dep.ErrContinue
+	ErrLeaseExpired = dep.ErrLeaseExpired
+)
 
-var ErrLeaseExpired = errors.New("lease expired or is not renewable")
+var regexUnexpectedResponseCode = regexp.MustCompile(
+	"Unexpected response code: ([0-9]{3})")
+
+// KindOther is the kind of dependencies without a kind or type annotation.
+const KindOther = "other"
+
+// Kind returns the kind of the dependency, either as set by the dependency
+// (dep.Kinder) or from its type annotation ("consul", "vault", "nomad" or
+// "file"). It returns KindOther if it has neither.
+func Kind(d dep.Dependency) string {
+	switch d := d.(type) {
+	case dep.Kinder:
+		return d.Kind()
+	case ConsulType:
+		return "consul"
+	case VaultType:
+		return "vault"
+	case NomadType:
+		return "nomad"
+	case FileType:
+		return "file"
+	}
+	return KindOther
+}
+
+// fetchError wraps an error from fetching the dependency with its ID and
+// classifies it.
+func fetchError(d dep.Dependency, err error) error {
+	return NewFetchError(Kind(d), d.ID(), pkgerrors.Wrap(err, d.ID()))
+}
+
+// NewFetchError classifies the error by its response status code. Errors
+// that are already a FetchError are returned as is.
+func NewFetchError(kind, id string, err error) *dep.FetchError {
+	var fe *dep.FetchError
+	if errors.As(err, &fe) {
+		return fe
+	}
+	code := ResponseCode(err)
+	return &dep.FetchError{
+		ID:         id,
+		Kind:       kind,
+		StatusCode: code,
+		Retryable:  retryable(code),
+		Err:        err,
+	}
+}
+
+// ResponseCode returns the HTTP status code from a Consul, Vault or Nomad API
+// error, or 0 if there isn't one.
+func ResponseCode(err error) int {
+	var fe *dep.FetchError
+	var consulErr consulapi.StatusError
+	var vaultErr *vaultapi.ResponseError
+	var nomadErr nomadapi.UnexpectedResponseError
+	switch {
+	case errors.As(err, &fe):
+		return fe.StatusCode
+	case errors.As(err, &consulErr):
+		return consulErr.Code
+	case errors.As(err, &vaultErr):
+		return vaultErr.StatusCode
+	case errors.As(err, &nomadErr):
+		return nomadErr.StatusCode()
+	}
+
+	// Older API errors (and fakes) only have the code in the message.
+	m := regexUnexpectedResponseCode.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	code, _ := strconv.Atoi(m[1])
+	return code
+}
+
+// retryable returns false for failures that will happen again on retry. A
+// permission denied is retried, as the token or ACL may be fixed meanwhile,
+// FetchError.PermissionDenied tells it apart.
+func retryable(code int) bool {
+	return code != http.StatusBadRequest
+}
@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFetchError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		err        error
+		code       int
+		retryable  bool
+		permDenied bool
+	}{
+		{
+			"network",
+			fmt.Errorf("dial tcp: connection refused"),
+			0,
+			true,
+			false,
+		},
+		{
+			"consul_500",
+			consulapi.StatusError{Code: 500, Body: "rpc error"},
+			500,
+			true,
+			false,
+		},
+		{
+			"consul_400",
+			consulapi.StatusError{Code: 400, Body: "bad request"},
+			400,
+			false,
+			false,
+		},
+		{
+			"vault_403",
+			&vaultapi.ResponseError{StatusCode: 403},
+			403,
+			true,
+			true,
+		},
+		{
+			"message_only",
+			fmt.Errorf("Unexpected response code: 503"),
+			503,
+			true,
+			false,
+		},
+		{
+			"file_permission",
+			&fs.PathError{Op: "open", Path: "/foo", Err: fs.ErrPermission},
+			0,
+			true,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &FakeDep{Name: tc.name}
+			err := fetchError(d, tc.err)
+
+			fe, ok := err.(*dep.FetchError)
+			if !assert.True(t, ok) {
+				return
+			}
+			assert.Equal(t, d.ID(), fe.ID)
+			assert.Equal(t, "consul", fe.Kind)
+			assert.Equal(t, tc.code, fe.StatusCode)
+			assert.Equal(t, tc.retryable, fe.Retryable)
+			assert.Equal(t, tc.permDenied, fe.PermissionDenied())
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, d.ID()+": "+tc.err.Error(), err.Error())
+		})
+	}
+}
+
+func TestErrorsAliasDep(t *testing.T) {
+	t.Parallel()
+
+	// the built-in dependencies' errors match the public ones
+	err := fmt.Errorf("catalog services: %w", ErrStopped)
+	assert.ErrorIs(t, err, dep.ErrStopped)
+	assert.ErrorIs(t, ErrContinue, dep.ErrContinue)
+	assert.ErrorIs(t, ErrLeaseExpired, dep.ErrLeaseExpired)
+}
@@ -137,14 +137,20 @@ func (d *FakeDepStale) String() string {
 
 ////////////
 // FakeDepFetchError is a fake dependency that returns an error while fetching.
+// The error has the response Code, defaulting to 500.
 type FakeDepFetchError struct {
 	FakeDep
 	Name string
+	Code int
 }
 
 func (d *FakeDepFetchError) Fetch(dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	time.Sleep(time.Microsecond)
-	return nil, nil, fmt.Errorf("Unexpected response code: 500")
+	code := d.Code
+	if code == 0 {
+		code = 500
+	}
+	return nil, nil, fmt.Errorf("Unexpected response code: %d", code)
 }
 
 func (d *FakeDepFetchError) ID() string {
@@ -244,3 +250,33 @@ func (d *FakeDepBlockingQuery) Stop() {
 		close(d.stop)
 	}
 }
+
+////////////
+// FakeDepPolling is a fake dependency that doesn't support blocking queries
+// and so is polled, waiting Wait between fetches.
+type FakeDepPolling struct {
+	FakeDep
+	Name  string
+	Wait  time.Duration
+	index uint64
+}
+
+var _ PollingQuery = (*FakeDepPolling)(nil)
+
+func (d *FakeDepPolling) Fetch(dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	d.index++
+	data := fmt.Sprintf("%s_%d", d.Name, d.index)
+	rm := &dep.ResponseMetadata{LastIndex: d.index}
+	return data, rm, nil
+}
+
+func (d *FakeDepPolling) PollingWait() time.Duration {
+	return d.Wait
+}
+
+func (d *FakeDepPolling) ID() string {
+	return fmt.Sprintf("test_dep_polling(%s)", d.Name)
+}
+func (d *FakeDepPolling) String() string {
+	return d.ID()
+}
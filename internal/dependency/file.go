@@ -11,12 +11,12 @@ import (
 	"time"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
 	// Ensure implements
 	_ isDependency = (*FileQuery)(nil)
+	_ PollingQuery = (*FileQuery)(nil)
 
 	// FileQuerySleepTime is the amount of time to sleep between queries, since
 	// the fsnotify library is not compatible with solaris and other OSes yet.
@@ -25,10 +25,14 @@ var (
 
 // FileQuery represents a local file dependency.
 type FileQuery struct {
+	isFile
 	stopCh chan struct{}
 
-	path string
-	stat os.FileInfo
+	path  string
+	stat  os.FileInfo
+	data  string
+	index uint64
+	opts  QueryOptions
 }
 
 // NewFileQuery creates a file dependency from the given path.
@@ -45,24 +49,39 @@ func NewFileQuery(s string) (*FileQuery, error) {
 }
 
 // Fetch retrieves this dependency and returns the result or any errors that
-// occur in the process.
+// occur in the process. If the file hasn't changed since the last fetch the
+// previous contents and index are returned.
 func (d *FileQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return "", nil, ErrStopped
-	case r := <-d.watch(d.stat):
-		if r.err != nil {
-			return "", nil, errors.Wrap(r.err, d.ID())
-		}
+	default:
+	}
 
+	stat, err := os.Stat(d.path)
+	if err != nil {
+		return "", nil, fetchError(d, err)
+	}
+
+	if fileChanged(d.stat, stat) {
 		data, err := ioutil.ReadFile(d.path)
 		if err != nil {
-			return "", nil, errors.Wrap(err, d.ID())
+			return "", nil, fetchError(d, err)
 		}
+		d.stat = stat
+		d.data = string(data)
+		d.index++
+	}
 
-		d.stat = r.stat
-		return respWithMetadata(string(data))
+	return d.data, &dep.ResponseMetadata{LastIndex: d.index}, nil
+}
+
+// PollingWait returns the time to wait between checks of the file.
+func (d *FileQuery) PollingWait() time.Duration {
+	if d.opts.PollingWait != 0 {
+		return d.opts.PollingWait
 	}
+	return FileQuerySleepTime
 }
 
 // CanShare returns a boolean if this dependency is shareable.
@@ -85,48 +104,13 @@ func (d *FileQuery) String() string {
 	return d.ID()
 }
 
-func (d *FileQuery) SetOptions(opts QueryOptions) {}
-
-type watchResult struct {
-	stat os.FileInfo
-	err  error
+func (d *FileQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
 }
 
-// watch watchers the file for changes
-func (d *FileQuery) watch(lastStat os.FileInfo) <-chan *watchResult {
-	ch := make(chan *watchResult, 1)
-
-	go func(lastStat os.FileInfo) {
-		for {
-			stat, err := os.Stat(d.path)
-			if err != nil {
-				select {
-				case <-d.stopCh:
-					return
-				case ch <- &watchResult{err: err}:
-					return
-				}
-			}
-
-			changed := lastStat == nil ||
-				lastStat.Size() != stat.Size() ||
-				lastStat.ModTime() != stat.ModTime()
-
-			if changed {
-				select {
-				case <-d.stopCh:
-					return
-				case ch <- &watchResult{stat: stat}:
-					return
-				}
-			}
-			select {
-			case <-d.stopCh:
-				return
-			case <-time.After(FileQuerySleepTime):
-			}
-		}
-	}(lastStat)
-
-	return ch
+// fileChanged compares the file stats to determine if the file has changed.
+func fileChanged(lastStat, stat os.FileInfo) bool {
+	return lastStat == nil ||
+		lastStat.Size() != stat.Size() ||
+		lastStat.ModTime() != stat.ModTime()
 }
@@ -159,13 +159,18 @@ func TestFileQuery_Fetch(t *testing.T) {
 		dataCh := make(chan interface{}, 1)
 		errCh := make(chan error, 1)
 		go func() {
+			var lastIndex uint64
 			for {
-				data, _, err := d.Fetch(nil)
+				data, rm, err := d.Fetch(nil)
 				if err != nil {
 					errCh <- err
 					return
 				}
-				dataCh <- data
+				if rm.LastIndex != lastIndex {
+					lastIndex = rm.LastIndex
+					dataCh <- data
+				}
+				time.Sleep(d.PollingWait())
 			}
 		}()
 		defer d.Stop()
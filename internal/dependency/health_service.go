@@ -10,9 +10,9 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/go-bexpr"
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 const (
@@ -68,6 +68,13 @@ type HealthServiceQuery struct {
 	// passingOnly filters for services that have an overall aggregated status
 	// of passing. When true, sdk adds ?passing=1 to api request
 	passingOnly bool
+
+	// cache are the agent cache options set by the template
+	cache cacheOpts
+
+	// noStreaming is set once the agent served a blocking query despite
+	// streaming being expected, ie. it doesn't support or enable it.
+	noStreaming bool
 }
 
 // NewHealthServiceQueryV1 processes the strings to build a service dependency.
@@ -125,6 +132,13 @@ func healthServiceQueryV1(service string, connect bool, opts []string) (*HealthS
 				healthServiceQuery.near = value
 				continue
 			}
+			ok, err := healthServiceQuery.cache.parse("health.service", query, value)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				continue
+			}
 		}
 
 		if strings.Contains(opt, "Checks.Status") {
@@ -200,12 +214,17 @@ func (d *HealthServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respo
 	default:
 	}
 
-	opts := d.opts.Merge(&QueryOptions{
+	opts := d.cache.merge(d.opts.Merge(&QueryOptions{
 		Datacenter: d.dc,
 		Filter:     d.filter,
 		Namespace:  d.ns,
 		Near:       d.near,
-	})
+	}))
+	// The agent serves streamed queries from its own view, leave its cache
+	// out of it
+	if d.Streaming() {
+		opts.UseCache = false
+	}
 
 	nodes := clients.Consul().Health().Service
 	if d.connect {
@@ -213,71 +232,51 @@ func (d *HealthServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respo
 	}
 	entries, qm, err := nodes(d.name, d.deprecatedTag, d.passingOnly, opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
+	}
+
+	// The agent uses streaming for blocking queries when its
+	// use_streaming_backend is set, the first (non-blocking) query never is.
+	if d.Streaming() && opts.WaitIndex != 0 &&
+		qm.QueryBackend != api.QueryBackendStreaming {
+		d.noStreaming = true
 	}
 
 	list := make([]*dep.HealthService, 0, len(entries))
 	for _, entry := range entries {
-		// Determine the overall status of this service from its checks.
-		status := entry.Checks.AggregatedStatus()
+		hs := newHealthService(entry)
 
 		// Do status filtering on client-side if there are non-passing status filters.
-		if !acceptStatus(d.deprecatedStatusFilters, status) {
+		if !acceptStatus(d.deprecatedStatusFilters, hs.Status) {
 			continue
 		}
 
-		// Get the address of the service, falling back to the address of the
-		// node.
-		address := entry.Service.Address
-		if address == "" {
-			address = entry.Node.Address
-		}
-
-		list = append(list, &dep.HealthService{
-			Node:                   entry.Node.Node,
-			NodeID:                 entry.Node.ID,
-			Kind:                   string(entry.Service.Kind),
-			NodeAddress:            entry.Node.Address,
-			NodeDatacenter:         entry.Node.Datacenter,
-			NodeTaggedAddresses:    entry.Node.TaggedAddresses,
-			NodeMeta:               entry.Node.Meta,
-			ServiceMeta:            entry.Service.Meta,
-			Address:                address,
-			ServiceTaggedAddresses: entry.Service.TaggedAddresses,
-			ID:                     entry.Service.ID,
-			Name:                   entry.Service.Service,
-			Tags: dep.ServiceTags(
-				deepCopyAndSortTags(entry.Service.Tags)),
-			Status:    status,
-			Checks:    entry.Checks,
-			Port:      entry.Service.Port,
-			Weights:   entry.Service.Weights,
-			Namespace: entry.Service.Namespace,
-			Proxy:     entry.Service.Proxy,
-		})
+		list = append(list, hs)
 	}
 
 	// Sort unless the user explicitly asked for nearness
 	if d.near == "" {
-		sort.SliceStable(list,
-			func(i, j int) bool {
-				if list[i].Node < list[j].Node {
-					return true
-				} else if list[i].Node == list[j].Node {
-					return list[i].ID < list[j].ID
-				}
-				return false
-			})
+		sortHealthServices(list)
 	}
 
 	rm := &dep.ResponseMetadata{
-		LastIndex:   qm.LastIndex,
-		LastContact: qm.LastContact,
+		LastIndex:    qm.LastIndex,
+		LastContact:  qm.LastContact,
+		QueryBackend: qm.QueryBackend,
 	}
+	cacheMetadata(rm, qm)
 
 	return list, rm, nil
 }
 
+// Streaming returns true if the agent is expected to stream the queries, ie.
+// UseStreaming is set and the agent hasn't served a blocking query with the
+// blocking-query backend. Streaming is an agent setting, the only change to
+// the queries is that they leave out the cache options.
+func (d *HealthServiceQuery) Streaming() bool {
+	return d.opts.UseStreaming && !d.noStreaming
+}
+
 // CanShare returns a boolean if this dependency is shareable.
 func (d *HealthServiceQuery) CanShare() bool {
 	return true
@@ -311,6 +310,7 @@ func (d *HealthServiceQuery) ID() string {
 	if d.filter != "" {
 		opts = append(opts, fmt.Sprintf("filter=%s", d.filter))
 	}
+	opts = append(opts, d.cache.id()...)
 	if len(opts) > 0 {
 		name = fmt.Sprintf("%s?%s", name, strings.Join(opts, "&"))
 	}
@@ -326,6 +326,53 @@ func (d *HealthServiceQuery) SetOptions(opts QueryOptions) {
 	d.opts = opts
 }
 
+// newHealthService converts a Consul service entry into a HealthService.
+func newHealthService(entry *api.ServiceEntry) *dep.HealthService {
+	// Get the address of the service, falling back to the address of the
+	// node.
+	address := entry.Service.Address
+	if address == "" {
+		address = entry.Node.Address
+	}
+
+	return &dep.HealthService{
+		Node:                   entry.Node.Node,
+		NodeID:                 entry.Node.ID,
+		Kind:                   string(entry.Service.Kind),
+		NodeAddress:            entry.Node.Address,
+		NodeDatacenter:         entry.Node.Datacenter,
+		NodeTaggedAddresses:    entry.Node.TaggedAddresses,
+		NodeMeta:               entry.Node.Meta,
+		ServiceMeta:            entry.Service.Meta,
+		Address:                address,
+		ServiceTaggedAddresses: entry.Service.TaggedAddresses,
+		ID:                     entry.Service.ID,
+		Name:                   entry.Service.Service,
+		Tags: dep.ServiceTags(
+			deepCopyAndSortTags(entry.Service.Tags)),
+		// Determine the overall status of this service from its checks.
+		Status:    entry.Checks.AggregatedStatus(),
+		Checks:    entry.Checks,
+		Port:      entry.Service.Port,
+		Weights:   entry.Service.Weights,
+		Namespace: entry.Service.Namespace,
+		Proxy:     entry.Service.Proxy,
+	}
+}
+
+// sortHealthServices sorts the services by node and then service ID.
+func sortHealthServices(list []*dep.HealthService) {
+	sort.SliceStable(list,
+		func(i, j int) bool {
+			if list[i].Node < list[j].Node {
+				return true
+			} else if list[i].Node == list[j].Node {
+				return list[i].ID < list[j].ID
+			}
+			return false
+		})
+}
+
 // acceptStatus returns if a check status matches the list of statuses to filter on
 func acceptStatus(filters []string, status string) bool {
 	if len(filters) == 0 {
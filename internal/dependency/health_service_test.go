@@ -5,7 +5,11 @@ package dependency
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/hcat/dep"
@@ -588,6 +592,41 @@ func TestNewHealthServiceQueryV1(t *testing.T) {
 				passingOnly: true,
 			},
 			false,
+		}, {
+			"cached",
+			[]string{"cached=true"},
+			&HealthServiceQuery{
+				name:        "name",
+				cache:       cacheOpts{use: true, set: true},
+				passingOnly: true,
+			},
+			false,
+		}, {
+			"not cached",
+			[]string{"cached=false", "max-age=30s"},
+			&HealthServiceQuery{
+				name:        "name",
+				cache:       cacheOpts{set: true, maxAge: 30 * time.Second},
+				passingOnly: true,
+			},
+			false,
+		}, {
+			"max-age",
+			[]string{"max-age=30s", "stale-if-error=1h"},
+			&HealthServiceQuery{
+				name: "name",
+				cache: cacheOpts{
+					maxAge:       30 * time.Second,
+					staleIfError: time.Hour,
+				},
+				passingOnly: true,
+			},
+			false,
+		}, {
+			"invalid max-age",
+			[]string{"max-age=soon"},
+			nil,
+			true,
 		}, {
 			"near",
 			[]string{"near=near"},
@@ -732,6 +771,14 @@ func TestHealthServiceQueryV1_String(t *testing.T) {
 			"multifilter",
 			[]string{"Checks.Status != passing", "mytag in Service.Tags"},
 			`health.service(name?filter=Checks.Status != passing and mytag in Service.Tags)`,
+		}, {
+			"cached",
+			[]string{"max-age=30s", "ns=ns"},
+			`health.service(name?ns=ns&cached=true&max-age=30s)`,
+		}, {
+			"not cached",
+			[]string{"cached=false"},
+			`health.service(name?cached=false)`,
 		},
 	}
 
@@ -831,6 +878,200 @@ func TestHealthServiceQueryV1_Fetch(t *testing.T) {
 	}
 }
 
+func TestHealthServiceQuery_FetchStreaming(t *testing.T) {
+	t.Parallel()
+
+	// fake agent reporting the backend it used for blocking queries, and
+	// whether the last query asked for its cache
+	var mux sync.Mutex
+	var cached bool
+	newAgent := func(t *testing.T, backend string) *ClientSet {
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v1/status/leader" {
+					fmt.Fprint(w, `"127.0.0.1:8300"`)
+					return
+				}
+				assert.Equal(t, "/v1/health/service/web", r.URL.Path)
+				mux.Lock()
+				_, cached = r.URL.Query()["cached"]
+				mux.Unlock()
+				w.Header().Set("X-Consul-Index", "10")
+				w.Header().Set("X-Consul-LastContact", "0")
+				if r.URL.Query().Get("index") != "" {
+					w.Header().Set("X-Consul-Query-Backend", backend)
+				} else {
+					w.Header().Set("X-Consul-Query-Backend",
+						api.QueryBackendBlockingQuery)
+				}
+				fmt.Fprint(w, "[]")
+			}))
+		t.Cleanup(ts.Close)
+
+		clients := NewClientSet()
+		err := clients.CreateConsulClient(&CreateClientInput{Address: ts.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(clients.Stop)
+		return clients
+	}
+
+	fetch := func(t *testing.T, d *HealthServiceQuery, clients *ClientSet,
+		index uint64) *dep.ResponseMetadata {
+		d.SetOptions(QueryOptions{UseStreaming: true, UseCache: true,
+			WaitIndex: index})
+		_, rm, err := d.Fetch(clients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rm
+	}
+	lastCached := func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return cached
+	}
+
+	t.Run("streaming", func(t *testing.T) {
+		clients := newAgent(t, api.QueryBackendStreaming)
+		d, err := NewHealthServiceQuery("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the first query isn't blocking, so isn't streamed
+		rm := fetch(t, d, clients, 0)
+		assert.Equal(t, api.QueryBackendBlockingQuery, rm.QueryBackend)
+		assert.True(t, d.Streaming())
+
+		assert.False(t, lastCached(), "streamed queries skip the cache")
+
+		rm = fetch(t, d, clients, 10)
+		assert.Equal(t, api.QueryBackendStreaming, rm.QueryBackend)
+		assert.True(t, d.Streaming())
+		assert.False(t, lastCached(), "streamed queries skip the cache")
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		clients := newAgent(t, api.QueryBackendBlockingQuery)
+		d, err := NewHealthServiceQuery("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fetch(t, d, clients, 0)
+		assert.True(t, d.Streaming())
+		rm := fetch(t, d, clients, 10)
+		assert.Equal(t, api.QueryBackendBlockingQuery, rm.QueryBackend)
+		assert.False(t, d.Streaming(), "expected fallback to blocking queries")
+		assert.False(t, lastCached())
+
+		// blocking queries use the cache again
+		fetch(t, d, clients, 10)
+		assert.True(t, lastCached(), "expected the cache used after fallback")
+	})
+
+	t.Run("not asked", func(t *testing.T) {
+		d, err := NewHealthServiceQuery("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, d.Streaming())
+	})
+}
+
+func TestHealthServiceQuery_FetchCache(t *testing.T) {
+	t.Parallel()
+
+	// fake agent answering from its cache when asked to
+	var query *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/status/leader" {
+				fmt.Fprint(w, `"127.0.0.1:8300"`)
+				return
+			}
+			query = r
+			w.Header().Set("X-Consul-Index", "10")
+			w.Header().Set("X-Consul-LastContact", "0")
+			if _, ok := r.URL.Query()["cached"]; ok {
+				w.Header().Set("X-Cache", "HIT")
+				w.Header().Set("Age", "5")
+			}
+			fmt.Fprint(w, "[]")
+		}))
+	defer ts.Close()
+
+	clients := NewClientSet()
+	err := clients.CreateConsulClient(&CreateClientInput{Address: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clients.Stop()
+
+	t.Run("cached", func(t *testing.T) {
+		d, err := NewHealthServiceQueryV1("web", []string{"max-age=30s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.SetOptions(QueryOptions{StaleIfError: time.Minute})
+		_, rm, err := d.Fetch(clients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cached := query.URL.Query()["cached"]
+		assert.True(t, cached)
+		assert.Equal(t, "max-age=30, stale-if-error=60",
+			query.Header.Get("Cache-Control"))
+		assert.True(t, rm.CacheHit)
+		assert.Equal(t, 5*time.Second, rm.CacheAge)
+	})
+
+	t.Run("uncached", func(t *testing.T) {
+		d, err := NewHealthServiceQueryV1("web", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rm, err := d.Fetch(clients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cached := query.URL.Query()["cached"]
+		assert.False(t, cached)
+		assert.False(t, rm.CacheHit)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		d, err := NewHealthServiceQueryV1("web", []string{"cached=false"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.SetOptions(QueryOptions{UseCache: true, MaxAge: time.Minute})
+		_, rm, err := d.Fetch(clients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cached := query.URL.Query()["cached"]
+		assert.False(t, cached, "cached=false overrides the watcher's cache")
+		assert.Empty(t, query.Header.Get("Cache-Control"))
+		assert.False(t, rm.CacheHit)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		d, err := NewHealthServiceQueryV1("web", []string{"cached=true"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.SetOptions(QueryOptions{UseStreaming: true})
+		if _, _, err := d.Fetch(clients); err != nil {
+			t.Fatal(err)
+		}
+		_, cached := query.URL.Query()["cached"]
+		assert.False(t, cached, "streaming queries aren't cached")
+	})
+}
+
 func Test_acceptStatus(t *testing.T) {
 	t.Parallel()
 
@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -115,7 +114,7 @@ func (d *KVExistsQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMe
 
 	pair, qm, err := clients.Consul().KV().Get(d.key, opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	rm := &dep.ResponseMetadata{
@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -87,7 +86,7 @@ func (d *KVExistsGetQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respons
 
 	pair, qm, err := clients.Consul().KV().Get(d.key, opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	rm := &dep.ResponseMetadata{
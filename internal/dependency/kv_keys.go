@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -58,7 +57,7 @@ func (d *KVKeysQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMeta
 
 	list, qm, err := clients.Consul().KV().Keys(d.prefix, "", opts.ToConsulOpts())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	keys := make([]string, len(list))
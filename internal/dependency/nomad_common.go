@@ -0,0 +1,110 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-bexpr"
+	"github.com/hashicorp/hcat/dep"
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// nomadOpts are the query parameters shared by the Nomad dependencies.
+type nomadOpts struct {
+	ns     string
+	region string
+	filter string
+}
+
+// parseNomadOpts processes options in the format of "key=value" (ns, region)
+// and filter expressions, which are joined with "and".
+func parseNomadOpts(prefix string, opts []string) (nomadOpts, error) {
+	var no nomadOpts
+	var filters []string
+	for _, opt := range opts {
+		if strings.TrimSpace(opt) == "" {
+			continue
+		}
+
+		if queryParamOptRe.MatchString(opt) {
+			query, value, err := stringsSplit2(opt, "=")
+			if err == nil {
+				switch query {
+				case "ns", "namespace":
+					no.ns = value
+					continue
+				case "region":
+					no.region = value
+					continue
+				}
+			}
+		}
+
+		if _, err := bexpr.CreateFilter(opt); err != nil {
+			return no, fmt.Errorf("%s: invalid filter: %q: %s", prefix, opt, err)
+		}
+		filters = append(filters, opt)
+	}
+
+	if len(filters) > 0 {
+		no.filter = strings.Join(filters, " and ")
+	}
+	return no, nil
+}
+
+// queryOptions returns the options as QueryOptions to merge with the view's.
+func (o nomadOpts) queryOptions() *QueryOptions {
+	return &QueryOptions{
+		Namespace: o.ns,
+		Region:    o.region,
+		Filter:    o.filter,
+	}
+}
+
+// toNomadOpts converts the options to the Nomad API's query options.
+func toNomadOpts(q *QueryOptions) *nomadapi.QueryOptions {
+	nq := nomadapi.QueryOptions{
+		AllowStale: q.AllowStale,
+		Filter:     q.Filter,
+		Namespace:  q.Namespace,
+		Region:     q.Region,
+		WaitIndex:  q.WaitIndex,
+		WaitTime:   q.WaitTime,
+	}
+
+	if ctx := q.Context(); ctx != nil {
+		return nq.WithContext(ctx)
+	}
+	return &nq
+}
+
+// id formats the name with the options for use in a dependency ID.
+func (o nomadOpts) id(name string) string {
+	if o.region != "" {
+		name = name + "@" + o.region
+	}
+
+	var opts []string
+	if o.ns != "" {
+		opts = append(opts, fmt.Sprintf("ns=%s", o.ns))
+	}
+	if o.filter != "" {
+		opts = append(opts, fmt.Sprintf("filter=%s", o.filter))
+	}
+	if len(opts) > 0 {
+		name = fmt.Sprintf("%s?%s", name, strings.Join(opts, "&"))
+	}
+	return name
+}
+
+// nomadClient returns the Nomad client from the clients.
+func nomadClient(clients dep.Clients) (*nomadapi.Client, error) {
+	client, ok := dep.Client[*nomadapi.Client](clients, NomadClientName)
+	if !ok || client == nil {
+		return nil, fmt.Errorf("nomad client not configured")
+	}
+	return client, nil
+}
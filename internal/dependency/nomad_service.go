@@ -0,0 +1,122 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+var (
+	// Ensure implements
+	_ isDependency = (*NomadServiceQuery)(nil)
+)
+
+func init() {
+	gob.Register([]*dep.NomadService{})
+}
+
+// NomadServiceQuery queries the Nomad API for the registrations of a service.
+type NomadServiceQuery struct {
+	isNomad
+	stopCh chan struct{}
+
+	name  string
+	nopts nomadOpts
+	opts  QueryOptions
+}
+
+// NewNomadServiceQueryV1 processes options in the format of "name key=value"
+// e.g. "web ns=default region=global". Options that aren't "key=value" pairs
+// are used as filter expressions.
+func NewNomadServiceQueryV1(name string, opts []string) (*NomadServiceQuery, error) {
+	if name == "" {
+		return nil, fmt.Errorf("nomad.service: service name required")
+	}
+
+	nopts, err := parseNomadOpts("nomad.service", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NomadServiceQuery{
+		stopCh: make(chan struct{}, 1),
+		name:   name,
+		nopts:  nopts,
+	}, nil
+}
+
+// Fetch queries the Nomad API defined by the given client.
+func (d *NomadServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	client, err := nomadClient(clients)
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	opts := d.opts.Merge(d.nopts.queryOptions())
+	regs, qm, err := client.Services().Get(d.name, toNomadOpts(opts))
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	list := make([]*dep.NomadService, 0, len(regs))
+	for _, s := range regs {
+		list = append(list, &dep.NomadService{
+			ID:         s.ID,
+			Name:       s.ServiceName,
+			Namespace:  s.Namespace,
+			NodeID:     s.NodeID,
+			Datacenter: s.Datacenter,
+			JobID:      s.JobID,
+			AllocID:    s.AllocID,
+			Tags:       dep.ServiceTags(deepCopyAndSortTags(s.Tags)),
+			Address:    s.Address,
+			Port:       s.Port,
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	rm := &dep.ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	return list, rm, nil
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *NomadServiceQuery) CanShare() bool {
+	return true
+}
+
+// ID returns the human-friendly version of this dependency.
+func (d *NomadServiceQuery) ID() string {
+	return fmt.Sprintf("nomad.service(%s)", d.nopts.id(d.name))
+}
+
+// Stringer interface reuses ID
+func (d *NomadServiceQuery) String() string {
+	return d.ID()
+}
+
+// Stop halts the dependency's fetch function.
+func (d *NomadServiceQuery) Stop() {
+	close(d.stopCh)
+}
+
+func (d *NomadServiceQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
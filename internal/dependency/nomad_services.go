@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+var (
+	// Ensure implements
+	_ isDependency = (*NomadServicesQuery)(nil)
+)
+
+func init() {
+	gob.Register([]*dep.NomadServicesSnippet{})
+}
+
+// NomadServicesQuery queries the Nomad API for the list of services.
+type NomadServicesQuery struct {
+	isNomad
+	stopCh chan struct{}
+
+	nopts nomadOpts
+	opts  QueryOptions
+}
+
+// NewNomadServicesQueryV1 processes options in the format of "key=value"
+// e.g. "ns=default". Options that aren't "key=value" pairs are used as filter
+// expressions.
+func NewNomadServicesQueryV1(opts []string) (*NomadServicesQuery, error) {
+	nopts, err := parseNomadOpts("nomad.services", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NomadServicesQuery{
+		stopCh: make(chan struct{}, 1),
+		nopts:  nopts,
+	}, nil
+}
+
+// Fetch queries the Nomad API defined by the given client.
+func (d *NomadServicesQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	client, err := nomadClient(clients)
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	opts := d.opts.Merge(d.nopts.queryOptions())
+	entries, qm, err := client.Services().List(toNomadOpts(opts))
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	var services []*dep.NomadServicesSnippet
+	for _, entry := range entries {
+		for _, s := range entry.Services {
+			services = append(services, &dep.NomadServicesSnippet{
+				Name:      s.ServiceName,
+				Namespace: entry.Namespace,
+				Tags:      dep.ServiceTags(deepCopyAndSortTags(s.Tags)),
+			})
+		}
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Namespace != services[j].Namespace {
+			return services[i].Namespace < services[j].Namespace
+		}
+		return services[i].Name < services[j].Name
+	})
+
+	rm := &dep.ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	return services, rm, nil
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *NomadServicesQuery) CanShare() bool {
+	return true
+}
+
+// ID returns the human-friendly version of this dependency.
+func (d *NomadServicesQuery) ID() string {
+	return fmt.Sprintf("nomad.services(%s)", d.nopts.id(""))
+}
+
+// Stringer interface reuses ID
+func (d *NomadServicesQuery) String() string {
+	return d.ID()
+}
+
+// Stop halts the dependency's fetch function.
+func (d *NomadServicesQuery) Stop() {
+	close(d.stopCh)
+}
+
+func (d *NomadServicesQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
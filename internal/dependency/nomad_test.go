@@ -0,0 +1,238 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcat/dep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNomadVarGetQueryV1(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		path string
+		opts []string
+		exp  *NomadVarGetQuery
+		err  bool
+	}{
+		{
+			"no path",
+			"",
+			[]string{},
+			nil,
+			true,
+		},
+		{
+			"path",
+			"/nomad/jobs/web/",
+			[]string{},
+			&NomadVarGetQuery{
+				path: "nomad/jobs/web",
+			},
+			false,
+		},
+		{
+			"options",
+			"nomad/jobs/web",
+			[]string{"ns=prod", "region=eu"},
+			&NomadVarGetQuery{
+				path:  "nomad/jobs/web",
+				nopts: nomadOpts{ns: "prod", region: "eu"},
+			},
+			false,
+		},
+		{
+			"filter",
+			"nomad/jobs/web",
+			[]string{`Path == "foo"`},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewNomadVarGetQueryV1(tc.path, tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.NoError(t, err, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestNewNomadServiceQueryV1(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		service string
+		opts    []string
+		exp     *NomadServiceQuery
+		err     bool
+	}{
+		{
+			"no name",
+			"",
+			[]string{},
+			nil,
+			true,
+		},
+		{
+			"filters",
+			"web",
+			[]string{"ns=prod", `"a" in Tags`, `Port == 80`},
+			&NomadServiceQuery{
+				name: "web",
+				nopts: nomadOpts{
+					ns:     "prod",
+					filter: `"a" in Tags and Port == 80`,
+				},
+			},
+			false,
+		},
+		{
+			"invalid filter",
+			"web",
+			[]string{"Port =="},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewNomadServiceQueryV1(tc.service, tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.NoError(t, err, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestNomadQueries_String(t *testing.T) {
+	t.Parallel()
+
+	opts := []string{"ns=prod", "region=eu"}
+	varGet, err := NewNomadVarGetQueryV1("nomad/jobs/web", opts)
+	assert.NoError(t, err)
+	varList, err := NewNomadVarListQueryV1("nomad/jobs", opts)
+	assert.NoError(t, err)
+	service, err := NewNomadServiceQueryV1("web",
+		append(opts, `"a" in Tags`))
+	assert.NoError(t, err)
+	services, err := NewNomadServicesQueryV1(nil)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		d   dep.Dependency
+		exp string
+	}{
+		{varGet, "nomad.var.get(nomad/jobs/web@eu?ns=prod)"},
+		{varList, "nomad.var.list(nomad/jobs@eu?ns=prod)"},
+		{service, `nomad.service(web@eu?ns=prod&filter="a" in Tags)`},
+		{services, "nomad.services()"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			assert.Equal(t, tc.exp, tc.d.ID())
+		})
+	}
+}
+
+func TestNomadVarGetQuery_Fetch(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/var/nomad/jobs/secret":
+				http.Error(w, "Permission denied", http.StatusForbidden)
+			case "/v1/var/nomad/jobs/web":
+				assert.Equal(t, "prod", r.URL.Query().Get("namespace"))
+				w.Header().Set("X-Nomad-Index", "7")
+				fmt.Fprint(w, `{"Path": "nomad/jobs/web", "Items": {"a": "b"}}`)
+			default:
+				w.Header().Set("X-Nomad-Index", "7")
+				http.NotFound(w, r)
+			}
+		}))
+	defer ts.Close()
+
+	clients := NewClientSet()
+	err := clients.CreateNomadClient(&CreateClientInput{Address: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clients.Stop()
+
+	t.Run("exists", func(t *testing.T) {
+		d, err := NewNomadVarGetQueryV1("nomad/jobs/web", []string{"ns=prod"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		act, rm, err := d.Fetch(clients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, dep.NomadVarItems{"a": "b"}, act)
+		assert.Equal(t, uint64(7), rm.LastIndex)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		d, err := NewNomadVarGetQueryV1("nomad/jobs/nope", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		act, _, err := d.Fetch(clients)
+		assert.NoError(t, err)
+		assert.Nil(t, act)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		d, err := NewNomadVarGetQueryV1("nomad/jobs/secret", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = d.Fetch(clients)
+		var fe *dep.FetchError
+		if !errors.As(err, &fe) {
+			t.Fatalf("expected a FetchError, got %v", err)
+		}
+		assert.True(t, fe.PermissionDenied())
+	})
+
+	t.Run("no client", func(t *testing.T) {
+		d, err := NewNomadVarGetQueryV1("nomad/jobs/web", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = d.Fetch(NewClientSet())
+		assert.Error(t, err)
+	})
+}
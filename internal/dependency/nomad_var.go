@@ -0,0 +1,141 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/hcat/dep"
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+var (
+	// Ensure implements
+	_ isDependency  = (*NomadVarGetQuery)(nil)
+	_ BlockingQuery = (*NomadVarGetQuery)(nil)
+)
+
+func init() {
+	gob.Register(dep.NomadVarItems{})
+}
+
+// NomadVarGetQuery queries the Nomad API for a single variable.
+type NomadVarGetQuery struct {
+	isNomad
+	isBlocking
+	stopCh chan struct{}
+
+	path  string
+	nopts nomadOpts
+	opts  QueryOptions
+}
+
+// NewNomadVarGetQueryV1 processes options in the format of "path key=value"
+// e.g. "nomad/jobs/web ns=default region=global"
+func NewNomadVarGetQueryV1(path string, opts []string) (*NomadVarGetQuery, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("nomad.var.get: path required")
+	}
+
+	nopts, err := parseNomadOpts("nomad.var.get", opts)
+	if err != nil {
+		return nil, err
+	}
+	if nopts.filter != "" {
+		return nil, fmt.Errorf("nomad.var.get: invalid query parameter: %q",
+			nopts.filter)
+	}
+
+	return &NomadVarGetQuery{
+		stopCh: make(chan struct{}, 1),
+		path:   path,
+		nopts:  nopts,
+	}, nil
+}
+
+// Fetch queries the Nomad API defined by the given client. A missing variable
+// returns nil, to block until it is there. A forbidden one returns an error.
+func (d *NomadVarGetQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	client, err := nomadClient(clients)
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	opts := d.opts.Merge(d.nopts.queryOptions())
+	v, qm, err := client.Variables().Peek(d.path, toNomadOpts(opts))
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	if v == nil {
+		// Peek returns nil for both a missing and a forbidden variable and
+		// doesn't block on the latter, so tell them apart to keep a 403 from
+		// spinning the blocking query.
+		if err := d.checkReadable(client, opts); err != nil {
+			return nil, nil, fetchError(d, err)
+		}
+	}
+
+	rm := &dep.ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	if v == nil {
+		return nil, rm, nil
+	}
+
+	items := make(dep.NomadVarItems, len(v.Items))
+	for k, val := range v.Items {
+		items[k] = val
+	}
+	return items, rm, nil
+}
+
+// checkReadable reads the variable without blocking, returning the API error
+// unless it is a 404.
+func (d *NomadVarGetQuery) checkReadable(client *nomadapi.Client, opts *QueryOptions) error {
+	q := *opts
+	q.WaitIndex, q.WaitTime = 0, 0
+	var v nomadapi.Variable
+	_, err := client.Raw().Query("/v1/var/"+d.path, &v, toNomadOpts(&q))
+	if ResponseCode(err) == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *NomadVarGetQuery) CanShare() bool {
+	return true
+}
+
+// ID returns the human-friendly version of this dependency.
+func (d *NomadVarGetQuery) ID() string {
+	return fmt.Sprintf("nomad.var.get(%s)", d.nopts.id(d.path))
+}
+
+// Stringer interface reuses ID
+func (d *NomadVarGetQuery) String() string {
+	return d.ID()
+}
+
+// Stop halts the dependency's fetch function.
+func (d *NomadVarGetQuery) Stop() {
+	close(d.stopCh)
+}
+
+func (d *NomadVarGetQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
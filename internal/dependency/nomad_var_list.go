@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+var (
+	// Ensure implements
+	_ isDependency = (*NomadVarListQuery)(nil)
+)
+
+func init() {
+	gob.Register([]*dep.NomadVarMeta{})
+}
+
+// NomadVarListQuery queries the Nomad API for the variables under a prefix.
+type NomadVarListQuery struct {
+	isNomad
+	stopCh chan struct{}
+
+	prefix string
+	nopts  nomadOpts
+	opts   QueryOptions
+}
+
+// NewNomadVarListQueryV1 processes options in the format of "prefix
+// key=value" e.g. "nomad/jobs ns=default". Options that aren't "key=value"
+// pairs are used as filter expressions.
+func NewNomadVarListQueryV1(prefix string, opts []string) (*NomadVarListQuery, error) {
+	nopts, err := parseNomadOpts("nomad.var.list", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NomadVarListQuery{
+		stopCh: make(chan struct{}, 1),
+		prefix: strings.Trim(prefix, "/"),
+		nopts:  nopts,
+	}, nil
+}
+
+// Fetch queries the Nomad API defined by the given client.
+func (d *NomadVarListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	client, err := nomadClient(clients)
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	opts := d.opts.Merge(d.nopts.queryOptions())
+	list, qm, err := client.Variables().PrefixList(d.prefix, toNomadOpts(opts))
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	vars := make([]*dep.NomadVarMeta, 0, len(list))
+	for _, v := range list {
+		vars = append(vars, &dep.NomadVarMeta{
+			Namespace:   v.Namespace,
+			Path:        v.Path,
+			CreateIndex: v.CreateIndex,
+			ModifyIndex: v.ModifyIndex,
+			CreateTime:  time.Unix(0, v.CreateTime),
+			ModifyTime:  time.Unix(0, v.ModifyTime),
+		})
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		if vars[i].Namespace != vars[j].Namespace {
+			return vars[i].Namespace < vars[j].Namespace
+		}
+		return vars[i].Path < vars[j].Path
+	})
+
+	rm := &dep.ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	return vars, rm, nil
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *NomadVarListQuery) CanShare() bool {
+	return true
+}
+
+// ID returns the human-friendly version of this dependency.
+func (d *NomadVarListQuery) ID() string {
+	return fmt.Sprintf("nomad.var.list(%s)", d.nopts.id(d.prefix))
+}
+
+// Stringer interface reuses ID
+func (d *NomadVarListQuery) String() string {
+	return d.ID()
+}
+
+// Stop halts the dependency's fetch function.
+func (d *NomadVarListQuery) Stop() {
+	close(d.stopCh)
+}
+
+func (d *NomadVarListQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
@@ -0,0 +1,172 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+var (
+	// Ensure implements
+	_ isDependency = (*PreparedQuery)(nil)
+	_ PollingQuery = (*PreparedQuery)(nil)
+
+	// PreparedQueryPollingWait is the amount of time to wait between
+	// executions of a prepared query, since the endpoint does not support
+	// blocking queries.
+	PreparedQueryPollingWait = 15 * time.Second
+)
+
+// PreparedQuery is the representation of a Consul prepared query execution
+// from inside a template. It returns the same results as a health service
+// query.
+type PreparedQuery struct {
+	isConsul
+	stopCh chan struct{}
+
+	name  string
+	dc    string
+	ns    string
+	near  string
+	cache cacheOpts
+	opts  QueryOptions
+}
+
+// NewPreparedQueryV1 processes the prepared query name or ID and options in
+// the format of "key=value" e.g. "dc=dc1" to build a prepared query
+// dependency.
+func NewPreparedQueryV1(query string, opts []string) (*PreparedQuery, error) {
+	if query == "" {
+		return nil, fmt.Errorf("prepared.query: query name or ID required")
+	}
+
+	preparedQuery := PreparedQuery{
+		stopCh: make(chan struct{}, 1),
+		name:   query,
+	}
+
+	for _, opt := range opts {
+		if strings.TrimSpace(opt) == "" {
+			continue
+		}
+
+		query, value, err := stringsSplit2(opt, "=")
+		if err != nil {
+			return nil, fmt.Errorf(
+				"prepared.query: invalid query parameter format: %q", opt)
+		}
+		switch query {
+		case "dc", "datacenter":
+			preparedQuery.dc = value
+		case "ns", "namespace":
+			preparedQuery.ns = value
+		case "near":
+			preparedQuery.near = value
+		default:
+			ok, err := preparedQuery.cache.parse("prepared.query", query, value)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf(
+					"prepared.query: invalid query parameter: %q", opt)
+			}
+		}
+	}
+
+	return &preparedQuery, nil
+}
+
+// Fetch executes the prepared query using the given client and returns a
+// slice of HealthService objects.
+func (d *PreparedQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	// The execute endpoint doesn't block, so drop the blocking options.
+	opts := d.cache.merge(d.opts.Merge(&QueryOptions{
+		Datacenter: d.dc,
+		Namespace:  d.ns,
+		Near:       d.near,
+	}))
+	opts.WaitIndex = 0
+	opts.WaitTime = 0
+
+	resp, qm, err := clients.Consul().PreparedQuery().Execute(
+		d.name, opts.ToConsulOpts())
+	if err != nil {
+		return nil, nil, fetchError(d, err)
+	}
+
+	list := make([]*dep.HealthService, 0, len(resp.Nodes))
+	for i := range resp.Nodes {
+		list = append(list, newHealthService(&resp.Nodes[i]))
+	}
+
+	// Consul shuffles the results unless they are sorted by nearness, so sort
+	// them to keep renders stable unless the user explicitly asked for it.
+	if d.near == "" {
+		sortHealthServices(list)
+	}
+
+	data, rm, err := respWithMetadata(list)
+	if rm != nil {
+		cacheMetadata(rm, qm)
+	}
+	return data, rm, err
+}
+
+// PollingWait returns the time to wait between executions of the query.
+func (d *PreparedQuery) PollingWait() time.Duration {
+	if d.opts.PollingWait != 0 {
+		return d.opts.PollingWait
+	}
+	return PreparedQueryPollingWait
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *PreparedQuery) CanShare() bool {
+	return true
+}
+
+// ID returns the human-friendly version of this dependency.
+func (d *PreparedQuery) ID() string {
+	name := d.name
+	if d.dc != "" {
+		name = name + "@" + d.dc
+	}
+	if d.near != "" {
+		name = name + "~" + d.near
+	}
+	var opts []string
+	if d.ns != "" {
+		opts = append(opts, fmt.Sprintf("ns=%s", d.ns))
+	}
+	opts = append(opts, d.cache.id()...)
+	if len(opts) > 0 {
+		name = fmt.Sprintf("%s?%s", name, strings.Join(opts, "&"))
+	}
+	return fmt.Sprintf("prepared.query(%s)", name)
+}
+
+// Stringer interface reuses ID
+func (d *PreparedQuery) String() string {
+	return d.ID()
+}
+
+// Stop halts the dependency's fetch function.
+func (d *PreparedQuery) Stop() {
+	close(d.stopCh)
+}
+
+func (d *PreparedQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
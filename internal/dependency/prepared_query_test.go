@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPreparedQueryV1(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		query string
+		opts  []string
+		exp   *PreparedQuery
+		err   bool
+	}{
+		{
+			"no query",
+			"",
+			[]string{},
+			nil,
+			true,
+		},
+		{
+			"no opts",
+			"query",
+			[]string{},
+			&PreparedQuery{
+				name: "query",
+			},
+			false,
+		},
+		{
+			"multiple",
+			"query",
+			[]string{"near=_agent", "ns=namespace", "dc=dc1"},
+			&PreparedQuery{
+				name: "query",
+				dc:   "dc1",
+				ns:   "namespace",
+				near: "_agent",
+			},
+			false,
+		},
+		{
+			"cached",
+			"query",
+			[]string{"max-age=1m"},
+			&PreparedQuery{
+				name:  "query",
+				cache: cacheOpts{maxAge: time.Minute},
+			},
+			false,
+		},
+		{
+			"invalid query",
+			"query",
+			[]string{"invalid=true"},
+			nil,
+			true,
+		},
+		{
+			"invalid query format",
+			"query",
+			[]string{"dc1"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewPreparedQueryV1(tc.query, tc.opts)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.NoError(t, err, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestPreparedQuery_Fetch(t *testing.T) {
+	t.Parallel()
+
+	pq := testClients.Consul().PreparedQuery()
+	id, _, err := pq.Create(&api.PreparedQueryDefinition{
+		Name:    "consul-query",
+		Service: api.ServiceQuery{Service: "consul"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pq.Delete(id, nil)
+
+	d, err := NewPreparedQueryV1("consul-query", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	act, _, err := d.Fetch(testClients)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := act.([]*dep.HealthService)
+	if assert.Len(t, services, 1) {
+		assert.Equal(t, "consul", services[0].Name)
+		assert.Equal(t, HealthPassing, services[0].Status)
+	}
+}
+
+func TestPreparedQuery_String(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		i    []string
+		exp  string
+	}{
+		{
+			"query",
+			[]string{},
+			"prepared.query(query)",
+		},
+		{
+			"datacenter",
+			[]string{"dc=dc1"},
+			"prepared.query(query@dc1)",
+		},
+		{
+			"multiple",
+			[]string{"near=_agent", "dc=dc1", "ns=namespace"},
+			"prepared.query(query@dc1~_agent?ns=namespace)",
+		},
+		{
+			"cached",
+			[]string{"cached=true", "ns=namespace"},
+			"prepared.query(query?ns=namespace&cached=true)",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewPreparedQueryV1("query", tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.exp, d.ID())
+		})
+	}
+}
@@ -10,11 +10,13 @@ import (
 	"time"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 // Ensure implements
-var _ isDependency = (*VaultAgentTokenQuery)(nil)
+var (
+	_ isDependency = (*VaultAgentTokenQuery)(nil)
+	_ PollingQuery = (*VaultAgentTokenQuery)(nil)
+)
 
 const (
 	// VaultAgentTokenSleepTime is the amount of time to sleep between queries, since
@@ -27,8 +29,10 @@ type VaultAgentTokenQuery struct {
 	isVault
 	stopCh chan struct{}
 
-	path string
-	stat os.FileInfo
+	path  string
+	stat  os.FileInfo
+	index uint64
+	opts  QueryOptions
 }
 
 // NewVaultAgentTokenQuery creates a new dependency.
@@ -40,26 +44,40 @@ func NewVaultAgentTokenQuery(path string) (*VaultAgentTokenQuery, error) {
 }
 
 // Fetch retrieves this dependency and returns the result or any errors that
-// occur in the process.
+// occur in the process. The client token is only updated when the token file
+// has changed since the last fetch.
 func (d *VaultAgentTokenQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return "", nil, ErrStopped
-	case r := <-d.watch(d.stat):
-		if r.err != nil {
-			return "", nil, errors.Wrap(r.err, d.ID())
-		}
+	default:
+	}
+
+	stat, err := os.Stat(d.path)
+	if err != nil {
+		return "", nil, fetchError(d, err)
+	}
 
+	if fileChanged(d.stat, stat) {
 		token, err := ioutil.ReadFile(d.path)
 		if err != nil {
-			return "", nil, errors.Wrap(err, d.ID())
+			return "", nil, fetchError(d, err)
 		}
 
-		d.stat = r.stat
+		d.stat = stat
+		d.index++
 		clients.Vault().SetToken(strings.TrimSpace(string(token)))
 	}
 
-	return respWithMetadata("")
+	return "", &dep.ResponseMetadata{LastIndex: d.index}, nil
+}
+
+// PollingWait returns the time to wait between checks of the token file.
+func (d *VaultAgentTokenQuery) PollingWait() time.Duration {
+	if d.opts.PollingWait != 0 {
+		return d.opts.PollingWait
+	}
+	return VaultAgentTokenSleepTime
 }
 
 // CanShare returns if this dependency is sharable.
@@ -82,44 +100,6 @@ func (d *VaultAgentTokenQuery) String() string {
 	return d.ID()
 }
 
-func (d *VaultAgentTokenQuery) SetOptions(opts QueryOptions) {}
-
-// watch watches the file for changes
-func (d *VaultAgentTokenQuery) watch(lastStat os.FileInfo) <-chan *watchResult {
-	ch := make(chan *watchResult, 1)
-
-	go func(lastStat os.FileInfo) {
-		for {
-			stat, err := os.Stat(d.path)
-			if err != nil {
-				select {
-				case <-d.stopCh:
-					return
-				case ch <- &watchResult{err: err}:
-					return
-				}
-			}
-
-			changed := lastStat == nil ||
-				lastStat.Size() != stat.Size() ||
-				lastStat.ModTime() != stat.ModTime()
-
-			if changed {
-				select {
-				case <-d.stopCh:
-					return
-				case ch <- &watchResult{stat: stat}:
-					return
-				}
-			}
-
-			select {
-			case <-d.stopCh:
-				return
-			case <-time.After(VaultAgentTokenSleepTime):
-			}
-		}
-	}(lastStat)
-
-	return ch
+func (d *VaultAgentTokenQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
 }
@@ -11,12 +11,12 @@ import (
 	"time"
 
 	"github.com/hashicorp/hcat/dep"
-	"github.com/pkg/errors"
 )
 
 var (
 	// Ensure implements
 	_ isDependency = (*VaultListQuery)(nil)
+	_ PollingQuery = (*VaultListQuery)(nil)
 )
 
 // VaultListQuery is the dependency to Vault for a secret
@@ -50,18 +50,6 @@ func (d *VaultListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	default:
 	}
 
-	opts := d.opts.Merge(&QueryOptions{})
-
-	// If this is not the first query, poll to simulate blocking-queries.
-	if opts.WaitIndex != 0 {
-		dur := opts.DefaultLease
-		select {
-		case <-d.stopCh:
-			return nil, nil, ErrStopped
-		case <-time.After(dur):
-		}
-	}
-
 	path := d.path
 	// Checking secret engine version. If it's v2, we should shim /metadata/
 	// to secret path if necessary.
@@ -73,7 +61,7 @@ func (d *VaultListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	// not renewable, or the renewal failed, so attempt a fresh list.
 	secret, err := clients.Vault().Logical().List(path)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	var result []string
@@ -106,6 +94,15 @@ func (d *VaultListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	return respWithMetadata(result)
 }
 
+// PollingWait returns the time to wait between lists to simulate blocking
+// queries. It defaults to the default lease duration.
+func (d *VaultListQuery) PollingWait() time.Duration {
+	if d.opts.PollingWait != 0 {
+		return d.opts.PollingWait
+	}
+	return d.opts.DefaultLease
+}
+
 // CanShare returns if this dependency is shareable.
 func (d *VaultListQuery) CanShare() bool {
 	return false
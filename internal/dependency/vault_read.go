@@ -15,13 +15,18 @@ import (
 )
 
 // Ensure implements
-var _ isDependency = (*VaultReadQuery)(nil)
+var (
+	_ isDependency = (*VaultReadQuery)(nil)
+	_ PollingQuery = (*VaultReadQuery)(nil)
+)
 
 // VaultReadQuery is the dependency to Vault for a secret
 type VaultReadQuery struct {
 	isVault
-	stopCh  chan struct{}
-	sleepCh chan time.Duration
+	stopCh chan struct{}
+	// pollingWait is the time to wait before re-reading a non-renewable
+	// secret, it is zero for renewable secrets.
+	pollingWait time.Duration
 
 	rawPath     string
 	queryValues url.Values
@@ -49,7 +54,6 @@ func NewVaultReadQuery(s string) (*VaultReadQuery, error) {
 
 	return &VaultReadQuery{
 		stopCh:      make(chan struct{}, 1),
-		sleepCh:     make(chan time.Duration, 1),
 		rawPath:     secretURL.Path,
 		queryValues: secretURL.Query(),
 	}, nil
@@ -60,13 +64,6 @@ func (d *VaultReadQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
-	case dur := <-d.sleepCh:
-		select {
-		case <-time.After(dur):
-			break
-		case <-d.stopCh:
-			return nil, nil, ErrStopped
-		}
 	default:
 	}
 
@@ -75,18 +72,18 @@ func (d *VaultReadQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	if !firstRun && vaultSecretRenewable(d.secret) {
 		err := renewSecret(clients, d)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, d.ID())
+			return nil, nil, fetchError(d, err)
 		}
 	}
 
 	err := d.fetchSecret(clients)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
+	d.pollingWait = 0
 	if !vaultSecretRenewable(d.secret) {
-		dur := leaseCheckWait(d.secret, nil)
-		d.sleepCh <- dur
+		d.pollingWait = leaseCheckWait(d.secret, nil)
 	}
 
 	return respWithMetadata(d.secret)
@@ -111,6 +108,12 @@ func (d *VaultReadQuery) secrets() (*dep.Secret, *api.Secret) {
 	return d.secret, d.vaultSecret
 }
 
+// PollingWait returns the time to wait before fetching a non-renewable
+// secret again.
+func (d *VaultReadQuery) PollingWait() time.Duration {
+	return d.pollingWait
+}
+
 // CanShare returns if this dependency is shareable.
 func (d *VaultReadQuery) CanShare() bool {
 	return false
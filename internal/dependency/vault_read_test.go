@@ -82,7 +82,6 @@ func TestNewVaultReadQuery(t *testing.T) {
 
 			if act != nil {
 				act.stopCh = nil
-				act.sleepCh = nil
 			}
 
 			assert.Equal(t, tc.exp, act)
@@ -260,10 +259,7 @@ func TestVaultReadQuery_Fetch_KVv1(t *testing.T) {
 		if err := <-errCh; err != nil {
 			t.Fatal(err)
 		}
-		if len(d.sleepCh) != 1 {
-			t.Fatalf("sleep channel has len %v, expected 1", len(d.sleepCh))
-		}
-		dur := <-d.sleepCh
+		dur := d.PollingWait()
 		if dur > 0 {
 			t.Fatalf("duration of sleep should be > 0")
 		}
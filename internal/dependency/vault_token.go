@@ -8,7 +8,6 @@ import (
 
 	"github.com/hashicorp/hcat/dep"
 	"github.com/hashicorp/vault/api"
-	"github.com/pkg/errors"
 )
 
 var (
@@ -52,7 +51,7 @@ func (d *VaultTokenQuery) Fetch(clients dep.Clients) (interface{}, *dep.Response
 	if vaultSecretRenewable(d.secret) {
 		err := renewSecret(clients, d)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, d.ID())
+			return nil, nil, fetchError(d, err)
 		}
 	}
 
@@ -17,13 +17,18 @@ import (
 )
 
 // Ensure implements
-var _ isDependency = (*VaultWriteQuery)(nil)
+var (
+	_ isDependency = (*VaultWriteQuery)(nil)
+	_ PollingQuery = (*VaultWriteQuery)(nil)
+)
 
 // VaultWriteQuery is the dependency to Vault for a secret
 type VaultWriteQuery struct {
 	isVault
-	stopCh  chan struct{}
-	sleepCh chan time.Duration
+	stopCh chan struct{}
+	// pollingWait is the time to wait before re-reading a non-renewable
+	// secret, it is zero for renewable secrets.
+	pollingWait time.Duration
 
 	path     string
 	data     map[string]interface{}
@@ -45,7 +50,6 @@ func NewVaultWriteQuery(s string, d map[string]interface{}) (*VaultWriteQuery, e
 
 	return &VaultWriteQuery{
 		stopCh:   make(chan struct{}, 1),
-		sleepCh:  make(chan time.Duration, 1),
 		path:     s,
 		data:     d,
 		dataHash: sha1Map(d),
@@ -57,13 +61,6 @@ func (d *VaultWriteQuery) Fetch(clients dep.Clients) (interface{}, *dep.Response
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
-	case dur := <-d.sleepCh:
-		select {
-		case <-time.After(dur):
-			break
-		case <-d.stopCh:
-			return nil, nil, ErrStopped
-		}
 	default:
 	}
 
@@ -72,14 +69,14 @@ func (d *VaultWriteQuery) Fetch(clients dep.Clients) (interface{}, *dep.Response
 	if !firstRun && vaultSecretRenewable(d.secret) {
 		err := renewSecret(clients, d)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, d.ID())
+			return nil, nil, fetchError(d, err)
 		}
 	}
 
 	opts := d.opts.Merge(&QueryOptions{})
 	vaultSecret, err := d.writeSecret(clients, opts)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.ID())
+		return nil, nil, fetchError(d, err)
 	}
 
 	// vaultSecret == nil when writing to KVv1 engines
@@ -91,9 +88,9 @@ func (d *VaultWriteQuery) Fetch(clients dep.Clients) (interface{}, *dep.Response
 	// cloned secret which will be exposed to the template
 	d.secret = transformSecret(vaultSecret, opts.DefaultLease)
 
+	d.pollingWait = 0
 	if !vaultSecretRenewable(d.secret) {
-		dur := leaseCheckWait(d.secret, nil)
-		d.sleepCh <- dur
+		d.pollingWait = leaseCheckWait(d.secret, nil)
 	}
 
 	return respWithMetadata(d.secret)
@@ -108,6 +105,12 @@ func (d *VaultWriteQuery) secrets() (*dep.Secret, *api.Secret) {
 	return d.secret, d.vaultSecret
 }
 
+// PollingWait returns the time to wait before fetching a non-renewable
+// secret again.
+func (d *VaultWriteQuery) PollingWait() time.Duration {
+	return d.pollingWait
+}
+
 // CanShare returns if this dependency is shareable.
 func (d *VaultWriteQuery) CanShare() bool {
 	return false
@@ -68,7 +68,6 @@ func TestNewVaultWriteQuery(t *testing.T) {
 
 			if act != nil {
 				act.stopCh = nil
-				act.sleepCh = nil
 			}
 
 			assert.Equal(t, tc.exp, act)
@@ -361,10 +360,7 @@ func TestVaultWriteQuery_Fetch(t *testing.T) {
 		if err := <-errCh; err != nil {
 			t.Fatal(err)
 		}
-		if len(d.sleepCh) != 1 {
-			t.Fatalf("sleep channel has len %v, expected 1", len(d.sleepCh))
-		}
-		dur := <-d.sleepCh
+		dur := d.PollingWait()
 		if dur > 0 {
 			t.Fatalf("duration of sleep should be > 0")
 		}
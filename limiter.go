@@ -0,0 +1,86 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// queryLimiter caps the number of queries in flight. Queries waiting for a
+// slot get them in the order they asked, so that no view is starved by
+// others with faster updates. A nil queryLimiter doesn't limit anything.
+type queryLimiter struct {
+	mux     sync.Mutex
+	max     int
+	active  int
+	waiting *list.List // of chan struct{}, closed when given a slot
+}
+
+// newQueryLimiter returns a limiter for max queries, nil if max isn't set.
+func newQueryLimiter(max int) *queryLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &queryLimiter{max: max, waiting: list.New()}
+}
+
+// acquire blocks until a slot is free, calling queued with the position in
+// the queue if it has to wait. It returns false if the context is done
+// first, otherwise release must be called when the query is done.
+func (l *queryLimiter) acquire(ctx context.Context, queued func(position int)) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mux.Lock()
+	if l.active < l.max {
+		l.active++
+		l.mux.Unlock()
+		return true
+	}
+	ready := make(chan struct{})
+	elem := l.waiting.PushBack(ready)
+	position := l.waiting.Len()
+	l.mux.Unlock()
+
+	queued(position)
+
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	select {
+	case <-ready:
+		// given the slot meanwhile, pass it on
+		l.releaseLocked()
+	default:
+		l.waiting.Remove(elem)
+	}
+	return false
+}
+
+// release frees the slot, handing it to the longest waiting query.
+func (l *queryLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.releaseLocked()
+}
+
+func (l *queryLimiter) releaseLocked() {
+	if front := l.waiting.Front(); front != nil {
+		l.waiting.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.active--
+}
@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat/events"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestQueryLimiter(t *testing.T) {
+	noQueue := func(int) { t.Error("shouldn't have to wait") }
+
+	t.Run("nil", func(t *testing.T) {
+		var l *queryLimiter
+		if newQueryLimiter(0) != nil {
+			t.Error("expected no limiter without max")
+		}
+		if !l.acquire(context.Background(), noQueue) {
+			t.Error("nil limiter should never block")
+		}
+		l.release()
+	})
+
+	t.Run("fifo", func(t *testing.T) {
+		l := newQueryLimiter(1)
+		if !l.acquire(context.Background(), noQueue) {
+			t.Fatal("expected a free slot")
+		}
+
+		// queue 3 queries, one at a time to know their order
+		order := make(chan int, 3)
+		for i := 1; i <= 3; i++ {
+			queued := make(chan int)
+			go func(i int) {
+				l.acquire(context.Background(), func(p int) { queued <- p })
+				order <- i
+			}(i)
+			if p := <-queued; p != i {
+				t.Fatalf("expected position %d, got %d", i, p)
+			}
+		}
+
+		for i := 1; i <= 3; i++ {
+			l.release()
+			select {
+			case got := <-order:
+				if got != i {
+					t.Fatalf("expected query %d to go next, got %d", i, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		l.release()
+		if l.active != 0 || l.waiting.Len() != 0 {
+			t.Errorf("expected empty limiter, active %d waiting %d",
+				l.active, l.waiting.Len())
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		l := newQueryLimiter(1)
+		l.acquire(context.Background(), noQueue)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+		go func() {
+			done <- l.acquire(ctx, func(int) { cancel() })
+		}()
+		if <-done {
+			t.Error("expected canceled acquire to fail")
+		}
+		if l.waiting.Len() != 0 {
+			t.Error("expected canceled query to leave the queue")
+		}
+
+		l.release()
+		if !l.acquire(context.Background(), noQueue) {
+			t.Error("expected the slot to be free")
+		}
+	})
+}
+
+func TestWatcherMaxConcurrentQueries(t *testing.T) {
+	queued := make(chan events.QueryQueued, 10)
+	w := NewWatcher(WatcherInput{
+		Clients:              NewClientSet(),
+		MaxConcurrentQueries: 1,
+		EventHandler: func(e events.Event) {
+			if e, ok := e.(events.QueryQueued); ok {
+				queued <- e
+			}
+		},
+	})
+	defer w.Stop()
+
+	// hold the only slot so the view has to wait
+	w.limiter.acquire(context.Background(), func(int) {})
+
+	d := &idep.FakeDep{Name: "foo"}
+	w.Track(fakeNotifier("foo"), d)
+	w.Poll(d)
+
+	select {
+	case e := <-queued:
+		if e.ID != d.ID() || e.Position != 1 {
+			t.Errorf("bad queued event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the view to be queued")
+	}
+
+	w.limiter.release()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.cache.Recall(d.ID()); !ok {
+		t.Error("expected data once the slot was released")
+	}
+}
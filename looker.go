@@ -4,17 +4,19 @@
 package hcat
 
 import (
+	"io"
 	"net/http"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/hcat/dep"
+	"github.com/hashicorp/hcat/events"
 	idep "github.com/hashicorp/hcat/internal/dependency"
 )
 
-// Looker is an interface for looking up data from Consul, Vault and the
-// Environment.
+// Looker is an interface for looking up data from Consul, Vault, any other
+// named clients and the Environment.
 type Looker interface {
 	dep.Clients
 	Env() []string
@@ -23,12 +25,18 @@ type Looker interface {
 
 // ClientSet focuses only on external (consul/vault) dependencies
 // at this point so we extend it here to include environment variables to meet
-// the looker interface.
+// the looker interface. The credentials of its Consul and Vault clients can
+// be rotated while in use, see RotateConsulToken, RotateVaultToken, ReloadTLS
+// and WatchTLSFiles, each reported as an event (see SetEventHandler). The
+// token and TLS file updates run until the set is stopped by its last user,
+// see Stop.
 type ClientSet struct {
 	*idep.ClientSet
 	// map of client-structs to retry functions
-	*sync.RWMutex // locking for env and retry
+	*sync.RWMutex // locking for env, retry and the event handler
 	injectedEnv   []string
+	// handlerSet is true once the credential event handler is set
+	handlerSet bool
 }
 
 // NewClientSet is used to create the clients used.
@@ -59,13 +67,33 @@ func (cs *ClientSet) AddConsul(i ConsulInput) error {
 	return cs.CreateConsulClient(i.toInternal())
 }
 
+// AddNomad creates a Nomad client and adds to the client set, as the "nomad"
+// named client, replacing the previous one.
+func (cs *ClientSet) AddNomad(i NomadInput) error {
+	return cs.CreateNomadClient(i.toInternal())
+}
+
 // AddVault creates a Vault client and adds to the client set
 func (cs *ClientSet) AddVault(i VaultInput) error {
 	return cs.CreateVaultClient(i.toInternal())
 }
 
+// AddClient adds a named client to the client set, for use by custom
+// dependencies (see dep.Client). It is closed when the set is stopped, see
+// Stop.
+func (cs *ClientSet) AddClient(i ClientInput) error {
+	closeFn := i.Close
+	if closer, ok := i.Client.(io.Closer); ok && closeFn == nil {
+		closeFn = func() { closer.Close() }
+	}
+	return cs.ClientSet.AddClient(i.Name, i.Client, closeFn)
+}
+
 // Stop closes all idle connections for any attached clients and clears
-// the list of injected environment variables.
+// the list of injected environment variables. Once stopped by its last user
+// (see Use), the Watchers using the set each being one, it also closes the
+// named clients, logs out of a Consul auth method login and stops the token
+// and TLS file updates.
 func (cs *ClientSet) Stop() {
 	if cs.ClientSet != nil {
 		cs.ClientSet.Stop()
@@ -73,6 +101,29 @@ func (cs *ClientSet) Stop() {
 	cs.injectedEnv = []string{}
 }
 
+// SetEventHandler sets the handler sent the events of the credential
+// rotations (see RotateConsulToken, RotateVaultToken, ReloadTLS and
+// WatchTLSFiles) and of the Consul token updates, CredentialsRotated and
+// CredentialsRotationFailed. Unless set, it is the EventHandler of the first
+// Watcher given the set.
+func (cs *ClientSet) SetEventHandler(handler events.EventHandler) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.handlerSet = true
+	cs.ClientSet.SetEventHandler(handler)
+}
+
+// useEventHandler sets the event handler unless already set.
+func (cs *ClientSet) useEventHandler(handler events.EventHandler) {
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.handlerSet {
+		return
+	}
+	cs.handlerSet = true
+	cs.ClientSet.SetEventHandler(handler)
+}
+
 // InjectEnv adds "key=value" pairs to the environment used for template
 // evaluations and child process runs. Note that this is in addition to the
 // environment running consul template and in the case of duplicates, the
@@ -114,6 +165,38 @@ func (i VaultInput) toInternal() *idep.CreateClientInput {
 	return i.Transport.toInternal(cci)
 }
 
+// ClientInput defines a named client to add to the client set.
+type ClientInput struct {
+	Name   string
+	Client interface{}
+	// Close is called when the client set is stopped by its last user (see
+	// ClientSet.Stop). Optional, defaults to calling Close if the Client
+	// implements io.Closer.
+	Close func()
+}
+
+// NomadInput defines the inputs needed to configure the Nomad client.
+type NomadInput struct {
+	Address   string
+	Namespace string
+	Region    string
+	Token     string
+	Transport TransportInput
+	// optional, principally for testing
+	HttpClient *http.Client
+}
+
+func (i NomadInput) toInternal() *idep.CreateClientInput {
+	cci := &idep.CreateClientInput{
+		Address:    i.Address,
+		Namespace:  i.Namespace,
+		Region:     i.Region,
+		Token:      i.Token,
+		HttpClient: i.HttpClient,
+	}
+	return i.Transport.toInternal(cci)
+}
+
 // ConsulInput defines the inputs needed to configure the Consul client.
 type ConsulInput struct {
 	Address      string
@@ -122,7 +205,18 @@ type ConsulInput struct {
 	AuthEnabled  bool
 	AuthUsername string
 	AuthPassword string
-	Transport    TransportInput
+	// TokenFile is read for the token instead, and re-read when it changes.
+	TokenFile string
+	// LoginAuthMethod is the ACL auth method (eg. Kubernetes or JWT) to log
+	// in with instead, using the LoginBearerToken or the content of the
+	// LoginBearerTokenFile (re-read on each login). The token is renewed by
+	// logging in again before it expires or when it is gone, and logged out
+	// when the client set is stopped by its last user (see ClientSet.Stop).
+	LoginAuthMethod      string
+	LoginBearerToken     string
+	LoginBearerTokenFile string
+	LoginMeta            map[string]string
+	Transport            TransportInput
 	// optional, principally for testing
 	HttpClient *http.Client
 }
@@ -135,6 +229,12 @@ func (i ConsulInput) toInternal() *idep.CreateClientInput {
 		AuthEnabled:  i.AuthEnabled,
 		AuthUsername: i.AuthUsername,
 		AuthPassword: i.AuthPassword,
+
+		TokenFile:            i.TokenFile,
+		LoginAuthMethod:      i.LoginAuthMethod,
+		LoginBearerToken:     i.LoginBearerToken,
+		LoginBearerTokenFile: i.LoginBearerTokenFile,
+		LoginMeta:            i.LoginMeta,
 	}
 	return i.Transport.toInternal(cci)
 }
@@ -149,6 +249,10 @@ type TransportInput struct {
 	SSLCAPath  string
 	ServerName string
 
+	// CustomDialer dials the connections in place of the default dialer
+	// (eg. an EndpointDialer), DialKeepAlive and DialTimeout are ignored.
+	CustomDialer TransportDialer
+
 	DialKeepAlive       time.Duration
 	DialTimeout         time.Duration
 	DisableKeepAlives   bool
@@ -166,6 +270,7 @@ func (i TransportInput) toInternal(cci *idep.CreateClientInput) *idep.CreateClie
 	cci.SSLCACert = i.SSLCACert
 	cci.SSLCAPath = i.SSLCAPath
 	cci.ServerName = i.ServerName
+	cci.TransportCustomDialer = i.CustomDialer
 	cci.TransportDialKeepAlive = i.DialKeepAlive
 	cci.TransportDialTimeout = i.DialTimeout
 	cci.TransportDisableKeepAlives = i.DisableKeepAlives
@@ -9,7 +9,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
+
+	"github.com/hashicorp/hcat/dep"
 )
 
 func TestClientSet(t *testing.T) {
@@ -40,6 +43,59 @@ func TestClientSet(t *testing.T) {
 		}
 	})
 
+	t.Run("nomad-replaced", func(t *testing.T) {
+		cs := NewClientSet()
+		defer cs.Stop()
+		if err := cs.AddNomad(NomadInput{Address: "http://127.0.0.1:4646"}); err != nil {
+			t.Fatal(err)
+		}
+		first, _ := cs.Client("nomad")
+		// like Consul and Vault, adding it again replaces it
+		if err := cs.AddNomad(NomadInput{Address: "http://127.0.0.1:4647"}); err != nil {
+			t.Fatal(err)
+		}
+		if second, ok := cs.Client("nomad"); !ok || second == first {
+			t.Error("expected the nomad client replaced")
+		}
+	})
+
+	t.Run("consul-login-logout", func(t *testing.T) {
+		var mux sync.Mutex
+		var loggedOut []string
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/status/leader":
+					fmt.Fprint(w, `"127.0.0.1:8300"`)
+				case "/v1/acl/login":
+					fmt.Fprint(w, `{"SecretID": "secret"}`)
+				case "/v1/acl/logout":
+					mux.Lock()
+					defer mux.Unlock()
+					loggedOut = append(loggedOut, r.Header.Get("X-Consul-Token"))
+				}
+			}))
+		defer ts.Close()
+
+		cs := NewClientSet()
+		err := cs.AddConsul(ConsulInput{
+			Address:          ts.URL,
+			LoginAuthMethod:  "k8s",
+			LoginBearerToken: "jwt",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a watcher using the set logs out when stopped
+		w := NewWatcher(WatcherInput{Clients: cs})
+		w.Stop()
+		mux.Lock()
+		defer mux.Unlock()
+		if len(loggedOut) != 1 || loggedOut[0] != "secret" {
+			t.Errorf("expected a logout on stop: %v", loggedOut)
+		}
+	})
+
 	t.Run("env", func(t *testing.T) {
 		cs := NewClientSet()
 		defer cs.Stop()
@@ -77,4 +133,66 @@ func TestClientSet(t *testing.T) {
 			t.Fatal("System environment variable failed")
 		}
 	})
+	t.Run("named-clients", func(t *testing.T) {
+		cs := NewClientSet()
+		var stopped, closed bool
+		err := cs.AddClient(ClientInput{
+			Name:   "nomad",
+			Client: &http.Client{},
+			Close: func() {
+				// using the client set in the hook must not deadlock
+				_, ok := cs.Client("db")
+				stopped = !ok
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cs.AddClient(ClientInput{
+			Name:   "db",
+			Client: fakeCloser(func() { closed = true }),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cs.AddClient(ClientInput{Name: "nomad", Client: 1}); err == nil {
+			t.Fatal("expected error adding duplicate client")
+		}
+
+		if c, ok := dep.Client[*http.Client](cs, "nomad"); !ok || c == nil {
+			t.Fatal("nomad client not found")
+		}
+		if _, ok := dep.Client[string](cs, "nomad"); ok {
+			t.Fatal("nomad client should not be a string")
+		}
+		if _, ok := dep.Client[*http.Client](cs, "missing"); ok {
+			t.Fatal("missing client should not be found")
+		}
+
+		// the set is shared, stopping it keeps the clients for the others
+		cs.Use()
+		cs.Use()
+		cs.Stop()
+		if stopped || closed {
+			t.Fatal("named clients should not be closed while in use")
+		}
+		if _, ok := cs.Client("nomad"); !ok {
+			t.Fatal("nomad client should be kept while in use")
+		}
+
+		cs.Stop()
+		if !stopped || !closed {
+			t.Fatal("named clients were not closed")
+		}
+		if _, ok := cs.Client("nomad"); ok {
+			t.Fatal("nomad client should be removed on stop")
+		}
+	})
+}
+
+type fakeCloser func()
+
+func (f fakeCloser) Close() error {
+	f()
+	return nil
 }
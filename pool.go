@@ -0,0 +1,284 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/hashicorp/hcat/dep"
+	"github.com/hashicorp/hcat/events"
+)
+
+// ViewPool shares the polling of dependencies between Watchers in a process.
+// Watchers given the same pool (see WatcherInput.ViewPool) and the same
+// clients make one upstream query per shareable dependency, its data being
+// sent to each of them.
+//
+// The shared query is configured (eg. retry function, blocking wait time)
+// by the first Watcher to track the dependency. It is reference counted, so
+// it keeps running until no Watcher uses it.
+type ViewPool struct {
+	mux   sync.Mutex
+	views map[poolKey]*sharedView
+}
+
+// NewViewPool returns an empty ViewPool.
+func NewViewPool() *ViewPool {
+	return &ViewPool{views: make(map[poolKey]*sharedView)}
+}
+
+// Size returns the number of shared upstream queries in the pool.
+func (p *ViewPool) Size() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return len(p.views)
+}
+
+// poolKey identifies a shared view. The clients are part of it as data
+// fetched with a client (and its credentials) isn't shared with others.
+type poolKey struct {
+	clients Looker
+	id      string
+}
+
+// shareable returns true if the dependency can be polled for many Watchers.
+func shareable(d dep.Dependency) bool {
+	s, ok := d.(interface{ CanShare() bool })
+	return ok && s.CanShare()
+}
+
+// acquire returns a new view for the dependency backed by the pool's shared
+// view, creating it if needed. The returned view must be stopped to release
+// the shared view.
+func (p *ViewPool) acquire(i *newViewInput) *view {
+	if i.Clients != nil && !reflect.TypeOf(i.Clients).Comparable() {
+		return newView(i)
+	}
+	key := poolKey{clients: i.Clients, id: i.Dependency.ID()}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	sv, ok := p.views[key]
+	if !ok {
+		sv = &sharedView{
+			pool: p,
+			key:  key,
+			subs: make(map[*view]*subscription),
+		}
+		upstream := *i
+		upstream.EventHandler = sv.event
+		// the upstream view can outlive the watcher
+		upstream.Goroutines = nil
+		sv.view = newView(&upstream)
+		p.views[key] = sv
+	}
+	sv.refs++
+
+	v := newView(i)
+	v.shared = sv
+	return v
+}
+
+// release drops a reference to the shared view, stopping it with the last.
+func (p *ViewPool) release(sv *sharedView) {
+	p.mux.Lock()
+	sv.refs--
+	last := sv.refs == 0
+	if last {
+		delete(p.views, sv.key)
+	}
+	p.mux.Unlock()
+
+	if last {
+		sv.view.stop()
+	}
+}
+
+// sharedView polls upstream for the views subscribed to it.
+type sharedView struct {
+	pool *ViewPool
+	key  poolKey
+	// view is the view polling upstream
+	view *view
+	// refs is the number of views using it, guarded by the pool's lock
+	refs int
+
+	mux     sync.Mutex
+	subs    map[*view]*subscription
+	polling bool
+}
+
+// subscription notifies a view of the shared view's data or error. Both
+// channels are buffered, so a slow Watcher doesn't hold up the others and
+// only gets the latest data.
+type subscription struct {
+	dataCh chan struct{}
+	errCh  chan error
+}
+
+// subscribe adds the view to those getting the data, starting the upstream
+// polling if needed.
+func (sv *sharedView) subscribe(v *view) *subscription {
+	sub := &subscription{
+		dataCh: make(chan struct{}, 1),
+		errCh:  make(chan error, 1),
+	}
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+	sv.subs[v] = sub
+
+	sv.view.dataLock.RLock()
+	received := sv.view.receivedData
+	sv.view.dataLock.RUnlock()
+	if received {
+		sub.dataCh <- struct{}{}
+	}
+
+	if !sv.polling {
+		sv.polling = true
+		go sv.run()
+	}
+	return sub
+}
+
+func (sv *sharedView) unsubscribe(v *view) {
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+	delete(sv.subs, v)
+}
+
+// run polls upstream until stopped or on error. The error is sent to the
+// subscribers, whose next poll restarts it.
+func (sv *sharedView) run() {
+	dataCh := make(chan *view)
+	errCh := make(chan error)
+	doneCh := make(chan struct{})
+	go func() {
+		sv.view.poll(dataCh, errCh)
+		close(doneCh)
+	}()
+
+	for {
+		select {
+		case <-dataCh:
+			sv.broadcast(nil)
+		case err := <-errCh:
+			// wait for poll to return so it can be restarted
+			<-doneCh
+			sv.stopped()
+			sv.broadcast(err)
+			return
+		case <-doneCh:
+			sv.stopped()
+			return
+		}
+	}
+}
+
+func (sv *sharedView) stopped() {
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+	sv.polling = false
+}
+
+// broadcast notifies the subscribers of new data, or of the error if not nil.
+func (sv *sharedView) broadcast(err error) {
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+	for _, sub := range sv.subs {
+		if err != nil {
+			select {
+			case sub.errCh <- err:
+			default:
+			}
+			continue
+		}
+		select {
+		case sub.dataCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// event passes the upstream view's events to the subscribers' handlers.
+func (sv *sharedView) event(e events.Event) {
+	sv.mux.Lock()
+	handlers := make([]events.EventHandler, 0, len(sv.subs))
+	for v := range sv.subs {
+		handlers = append(handlers, v.event)
+	}
+	sv.mux.Unlock()
+
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
+
+// pollShared is poll for views backed by a shared view. It passes on the
+// shared view's data and errors instead of fetching them.
+func (v *view) pollShared(viewCh chan<- *view, errCh chan<- error) {
+	v.event(events.TrackStart{ID: v.ID()})
+
+	alreadyPolling, stoppedPolling := v.pollingFlag()
+	if alreadyPolling {
+		return
+	}
+	defer func() {
+		stoppedPolling()
+		v.event(events.TrackStop{ID: v.ID()})
+	}()
+
+	sub := v.shared.subscribe(v)
+	defer v.shared.unsubscribe(v)
+
+	for {
+		select {
+		case <-sub.dataCh:
+			if !v.copyData(v.shared.view) {
+				continue
+			}
+			select {
+			case <-v.stopCh:
+				return
+			case viewCh <- v:
+			}
+		case err := <-sub.errCh:
+			v.dataLock.Lock()
+			v.errors++
+			v.lastError = err.Error()
+			v.dataLock.Unlock()
+			select {
+			case <-v.stopCh:
+			case errCh <- err:
+			}
+			return
+		case <-v.stopCh:
+			return
+		}
+	}
+}
+
+// copyData copies the data from the other view, returning false if there
+// was nothing new.
+func (v *view) copyData(from *view) bool {
+	from.dataLock.RLock()
+	data, index := from.data, from.lastIndex
+	received, lastFetch := from.receivedData, from.lastFetch
+	fetches, backend := from.fetches, from.queryBackend
+	from.dataLock.RUnlock()
+
+	v.dataLock.Lock()
+	defer v.dataLock.Unlock()
+	if !received || (v.receivedData && v.lastIndex == index &&
+		reflect.DeepEqual(v.data, data)) {
+		return false
+	}
+	v.data = data
+	v.lastIndex = index
+	v.lastFetch = lastFetch
+	v.fetches, v.queryBackend = fetches, backend
+	v.receivedData = true
+	return true
+}
@@ -0,0 +1,165 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// countingDep counts its fetches, blocking after the first until stopped.
+type countingDep struct {
+	idep.FakeDep
+	fetches int32
+}
+
+func (d *countingDep) Fetch(c dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	if atomic.AddInt32(&d.fetches, 1) > 1 {
+		<-d.Opts.Context().Done()
+		return nil, nil, context.Canceled
+	}
+	return d.FakeDep.Fetch(c)
+}
+
+func newPoolWatcher(pool *ViewPool, clients Looker) *Watcher {
+	noRetry := func(int) (bool, time.Duration) { return false, 0 }
+	return NewWatcher(WatcherInput{
+		Clients:         clients,
+		Cache:           NewStore(),
+		ViewPool:        pool,
+		ConsulRetryFunc: noRetry,
+	})
+}
+
+func waitData(t *testing.T, w *Watcher) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return w.Wait(ctx)
+}
+
+func TestViewPool(t *testing.T) {
+	t.Run("shared", func(t *testing.T) {
+		pool, clients := NewViewPool(), NewClientSet()
+		w1, w2 := newPoolWatcher(pool, clients), newPoolWatcher(pool, clients)
+		defer w1.Stop()
+		defer w2.Stop()
+
+		d1 := &countingDep{FakeDep: idep.FakeDep{Name: "web"}}
+		d2 := &countingDep{FakeDep: idep.FakeDep{Name: "web"}}
+		n1, n2 := fakeNotifier("t1"), fakeNotifier("t2")
+		w1.Track(n1, d1)
+		w2.Track(n2, d2)
+		w1.Poll(d1)
+		w2.Poll(d2)
+
+		for _, w := range []*Watcher{w1, w2} {
+			if err := waitData(t, w); err != nil {
+				t.Fatal(err)
+			}
+			if data, ok := w.cache.Recall(d1.ID()); !ok || data != "web" {
+				t.Errorf("expected data, got %v", data)
+			}
+		}
+		if pool.Size() != 1 {
+			t.Errorf("expected 1 shared view, got %d", pool.Size())
+		}
+		f1, f2 := atomic.LoadInt32(&d1.fetches), atomic.LoadInt32(&d2.fetches)
+		if f1 != 0 && f2 != 0 {
+			t.Errorf("expected one upstream query, got fetches %d and %d", f1, f2)
+		}
+
+		// sweeping one watcher keeps the query running for the other
+		w1.MarkForSweep(n1)
+		w1.Sweep(n1)
+		if w1.Watching(d1.ID()) || !w2.Watching(d2.ID()) {
+			t.Error("expected only the second watcher to be watching")
+		}
+		if pool.Size() != 1 {
+			t.Errorf("expected shared view to be kept, got %d", pool.Size())
+		}
+		sv := w2.view(d2.ID()).shared
+		select {
+		case <-sv.view.stopCh:
+			t.Error("shared view shouldn't be stopped")
+		default:
+		}
+
+		w2.Stop()
+		if pool.Size() != 0 {
+			t.Errorf("expected empty pool, got %d", pool.Size())
+		}
+		select {
+		case <-sv.view.stopCh:
+		default:
+			t.Error("shared view should be stopped")
+		}
+	})
+
+	t.Run("same-watcher", func(t *testing.T) {
+		pool := NewViewPool()
+		w := newPoolWatcher(pool, NewClientSet())
+		defer w.Stop()
+
+		d := &idep.FakeDep{Name: "web"}
+		n1, n2 := fakeNotifier("t1"), fakeNotifier("t2")
+		w.Track(n1, d)
+		w.Track(n2, d)
+		if pool.Size() != 1 {
+			t.Fatalf("expected 1 shared view, got %d", pool.Size())
+		}
+		sv := w.view(d.ID()).shared
+
+		w.MarkForSweep(n1)
+		w.Sweep(n1)
+		w.MarkForSweep(n2)
+		w.Sweep(n2)
+		if pool.Size() != 0 || sv.refs != 0 {
+			t.Errorf("expected view released, size %d refs %d", pool.Size(), sv.refs)
+		}
+	})
+
+	t.Run("different-clients", func(t *testing.T) {
+		pool := NewViewPool()
+		w1 := newPoolWatcher(pool, NewClientSet())
+		w2 := newPoolWatcher(pool, NewClientSet())
+		defer w1.Stop()
+		defer w2.Stop()
+
+		w1.Track(fakeNotifier("t1"), &idep.FakeDep{Name: "web"})
+		w2.Track(fakeNotifier("t2"), &idep.FakeDep{Name: "web"})
+		if pool.Size() != 2 {
+			t.Errorf("expected 2 shared views, got %d", pool.Size())
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		pool, clients := NewViewPool(), NewClientSet()
+		w1, w2 := newPoolWatcher(pool, clients), newPoolWatcher(pool, clients)
+		defer w1.Stop()
+		defer w2.Stop()
+
+		d1 := &idep.FakeDepFetchError{Name: "web"}
+		d2 := &idep.FakeDepFetchError{Name: "web"}
+		w1.Track(fakeNotifier("t1"), d1)
+		w2.Track(fakeNotifier("t2"), d2)
+		w1.Poll(d1)
+		w2.Poll(d2)
+
+		for _, w := range []*Watcher{w1, w2} {
+			if err := waitData(t, w); err == nil {
+				t.Error("expected the error to be sent to both watchers")
+			}
+		}
+		snap := w1.Snapshot().Views[0]
+		if snap.Errors != 1 || snap.LastError == "" {
+			t.Errorf("bad view snapshot: %+v", snap)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// DependencyKind is the class of a dependency. It is used to pick the retry
+// function to use when fetching the dependency fails.
+type DependencyKind string
+
+const (
+	// KindConsul is for dependencies that query Consul.
+	KindConsul DependencyKind = "consul"
+	// KindVault is for dependencies that query Vault.
+	KindVault DependencyKind = "vault"
+	// KindNomad is for dependencies that query Nomad.
+	KindNomad DependencyKind = "nomad"
+	// KindFile is for dependencies that read local files.
+	KindFile DependencyKind = "file"
+	// KindOther is for all other dependencies, including custom ones.
+	KindOther DependencyKind = idep.KindOther
+)
+
+// defaultRetryFunc is the retry function of the kinds given none, retrying
+// with a jittered exponential backoff for up to 5 minutes.
+var defaultRetryFunc = WithJitter(WithMaxElapsedTime(ExponentialBackoff(
+	BackoffInput{Base: 250 * time.Millisecond, Max: time.Minute}),
+	5*time.Minute), 0.2)
+
+// dependencyKinds are the kinds given the default retry function.
+var dependencyKinds = []DependencyKind{
+	KindConsul, KindVault, KindNomad, KindFile, KindOther,
+}
+
+// dependencyKind returns the kind of the dependency based on the type
+// annotations it implements.
+func dependencyKind(d dep.Dependency) DependencyKind {
+	return DependencyKind(idep.Kind(d))
+}
+
+// retryPolicies is a threadsafe registry of retry functions by dependency
+// kind, with optional per notifier (template) overrides.
+type retryPolicies struct {
+	sync.RWMutex
+	funcs     map[DependencyKind]RetryFunc
+	overrides map[string]map[DependencyKind]RetryFunc
+}
+
+func newRetryPolicies(funcs map[DependencyKind]RetryFunc) *retryPolicies {
+	rp := &retryPolicies{
+		funcs:     make(map[DependencyKind]RetryFunc, len(funcs)),
+		overrides: make(map[string]map[DependencyKind]RetryFunc),
+	}
+	for kind, f := range funcs {
+		rp.funcs[kind] = f
+	}
+	return rp
+}
+
+// setDefaults replaces the retry functions by kind, keeping the overrides.
+func (rp *retryPolicies) setDefaults(funcs map[DependencyKind]RetryFunc) {
+	rp.Lock()
+	defer rp.Unlock()
+	rp.funcs = make(map[DependencyKind]RetryFunc, len(funcs))
+	for kind, f := range funcs {
+		rp.funcs[kind] = f
+	}
+}
+
+// set registers the retry function for the kind, for the given notifiers or
+// for the watcher as a whole if none are given.
+func (rp *retryPolicies) set(kind DependencyKind, f RetryFunc, notifierIDs ...string) {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if len(notifierIDs) == 0 {
+		rp.funcs[kind] = f
+		return
+	}
+	for _, id := range notifierIDs {
+		if rp.overrides[id] == nil {
+			rp.overrides[id] = make(map[DependencyKind]RetryFunc)
+		}
+		rp.overrides[id][kind] = f
+	}
+}
+
+// lookup returns the retry function for the kind, preferring the notifier's
+// override. The returned bool is true if the override was used.
+func (rp *retryPolicies) lookup(kind DependencyKind, notifierID string) (RetryFunc, bool) {
+	rp.RLock()
+	defer rp.RUnlock()
+
+	if f, ok := rp.overrides[notifierID][kind]; ok {
+		return f, true
+	}
+	return rp.funcs[kind], false
+}
+
+// BackoffInput configures the retry function returned by ExponentialBackoff.
+type BackoffInput struct {
+	// Base is the sleep before the first retry, it doubles on each attempt.
+	Base time.Duration
+	// Max caps the sleep between attempts. Zero means no cap.
+	Max time.Duration
+	// MaxAttempts is the number of retries before giving up. Zero means no
+	// limit.
+	MaxAttempts int
+}
+
+// maxBackoff is the longest sleep ExponentialBackoff returns, doubling stops
+// here instead of overflowing when there is no Max.
+const maxBackoff = time.Duration(math.MaxInt64)
+
+// ExponentialBackoff returns a RetryFunc that doubles the sleep between
+// attempts, starting at Base and capped at Max.
+func ExponentialBackoff(i BackoffInput) RetryFunc {
+	return func(attempt int) (bool, time.Duration) {
+		if i.MaxAttempts > 0 && attempt >= i.MaxAttempts {
+			return false, 0
+		}
+		sleep := i.Base
+		for n := 0; n < attempt && sleep > 0; n++ {
+			if sleep > maxBackoff/2 {
+				sleep = maxBackoff
+				break
+			}
+			sleep *= 2
+			if i.Max > 0 && sleep >= i.Max {
+				break
+			}
+		}
+		if i.Max > 0 && sleep > i.Max {
+			sleep = i.Max
+		}
+		return true, sleep
+	}
+}
+
+// WithJitter wraps the RetryFunc to randomize each sleep by up to the
+// fraction of it, in either direction. This keeps many views from retrying
+// in lockstep after a shared upstream outage. The fraction is clamped to the
+// range 0-1, so the sleep never goes negative.
+func WithJitter(f RetryFunc, fraction float64) RetryFunc {
+	if fraction > 1 {
+		fraction = 1
+	}
+	return func(attempt int) (bool, time.Duration) {
+		retry, sleep := f(attempt)
+		if !retry || sleep <= 0 || fraction <= 0 {
+			return retry, sleep
+		}
+		delta := fraction * float64(sleep)
+		jittered := float64(sleep) - delta + rand.Float64()*2*delta
+		if jittered >= float64(maxBackoff) {
+			return true, maxBackoff
+		}
+		return true, time.Duration(jittered)
+	}
+}
+
+// WithMaxElapsedTime wraps the RetryFunc to stop retrying once the sum of the
+// sleeps up to and including the attempt exceeds max. Apply WithJitter
+// outside of this so the elapsed time is calculated without the jitter.
+func WithMaxElapsedTime(f RetryFunc, max time.Duration) RetryFunc {
+	return func(attempt int) (bool, time.Duration) {
+		var elapsed time.Duration
+		for n := 0; n <= attempt; n++ {
+			retry, sleep := f(n)
+			if !retry || sleep > max-elapsed {
+				return false, 0
+			}
+			elapsed += sleep
+		}
+		return f(attempt)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// otherDep is a dependency with no kind annotation
+type otherDep struct{}
+
+func (otherDep) Fetch(dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return nil, nil, nil
+}
+func (otherDep) ID() string     { return "other" }
+func (otherDep) String() string { return "other" }
+func (otherDep) Stop()          {}
+
+// customDep is a dependency annotated using the public dep package
+type customDep struct {
+	otherDep
+	dep.IsBlocking
+	kind string
+}
+
+func (d customDep) Kind() string { return d.kind }
+
+func TestDependencyKind(t *testing.T) {
+	t.Run("consul", func(t *testing.T) {
+		if k := dependencyKind(&idep.FakeDep{}); k != KindConsul {
+			t.Fatalf("bad kind: %s", k)
+		}
+	})
+	t.Run("file", func(t *testing.T) {
+		d, err := idep.NewFileQuery("/tmp/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k := dependencyKind(d); k != KindFile {
+			t.Fatalf("bad kind: %s", k)
+		}
+	})
+	t.Run("other", func(t *testing.T) {
+		if k := dependencyKind(otherDep{}); k != KindOther {
+			t.Fatalf("bad kind: %s", k)
+		}
+	})
+	t.Run("custom", func(t *testing.T) {
+		var d dep.Dependency = customDep{kind: "nomad"}
+		if k := dependencyKind(d); k != "nomad" {
+			t.Fatalf("bad kind: %s", k)
+		}
+		if _, ok := d.(idep.BlockingQuery); !ok {
+			t.Fatal("expected custom dependency to be a blocking query")
+		}
+	})
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	f := ExponentialBackoff(BackoffInput{
+		Base:        time.Second,
+		Max:         5 * time.Second,
+		MaxAttempts: 5,
+	})
+	exp := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second,
+		5 * time.Second, 5 * time.Second,
+	}
+	for attempt, e := range exp {
+		retry, sleep := f(attempt)
+		if !retry {
+			t.Fatalf("attempt %d: expected retry", attempt)
+		}
+		if sleep != e {
+			t.Fatalf("attempt %d: expected %s, got %s", attempt, e, sleep)
+		}
+	}
+	if retry, _ := f(len(exp)); retry {
+		t.Fatal("expected no retry after max attempts")
+	}
+}
+
+func TestExponentialBackoff_overflow(t *testing.T) {
+	f := ExponentialBackoff(BackoffInput{Base: time.Second})
+	prev := time.Duration(0)
+	for _, attempt := range []int{10, 40, 63, 64, 100, 1 << 20} {
+		retry, sleep := f(attempt)
+		if !retry {
+			t.Fatalf("attempt %d: expected retry", attempt)
+		}
+		if sleep < prev {
+			t.Fatalf("attempt %d: sleep went down to %s", attempt, sleep)
+		}
+		prev = sleep
+	}
+	if prev != maxBackoff {
+		t.Fatalf("expected sleep to be capped at %s, got %s", maxBackoff, prev)
+	}
+
+	if _, sleep := WithJitter(f, 0.5)(100); sleep <= 0 {
+		t.Fatalf("expected jittered sleep to stay positive, got %s", sleep)
+	}
+
+	f = WithMaxElapsedTime(f, time.Hour)
+	if retry, _ := f(100); retry {
+		t.Fatal("expected no retry after max elapsed time")
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	f := WithJitter(ExponentialBackoff(BackoffInput{Base: time.Second}), 0.5)
+	for i := 0; i < 100; i++ {
+		_, sleep := f(0)
+		if sleep < 500*time.Millisecond || sleep > 1500*time.Millisecond {
+			t.Fatalf("sleep out of range: %s", sleep)
+		}
+	}
+
+	// fractions above 1 are clamped to 1
+	f = WithJitter(ExponentialBackoff(BackoffInput{Base: time.Second}), 5)
+	for i := 0; i < 100; i++ {
+		_, sleep := f(0)
+		if sleep < 0 || sleep > 2*time.Second {
+			t.Fatalf("sleep out of range: %s", sleep)
+		}
+	}
+}
+
+func TestWithMaxElapsedTime(t *testing.T) {
+	// sleeps of 1, 2, 4, 8 seconds; elapsed of 1, 3, 7, 15 seconds
+	f := WithMaxElapsedTime(
+		ExponentialBackoff(BackoffInput{Base: time.Second}), 10*time.Second)
+	for attempt := 0; attempt < 3; attempt++ {
+		if retry, _ := f(attempt); !retry {
+			t.Fatalf("attempt %d: expected retry", attempt)
+		}
+	}
+	if retry, _ := f(3); retry {
+		t.Fatal("expected no retry after max elapsed time")
+	}
+}
+
+func TestRetryPolicies(t *testing.T) {
+	never := func(int) (bool, time.Duration) { return false, 0 }
+	rp := newRetryPolicies(map[DependencyKind]RetryFunc{KindConsul: never})
+	rp.set(KindVault, never, "foo")
+
+	if f, override := rp.lookup(KindConsul, "foo"); f == nil || override {
+		t.Fatal("expected watcher default for consul")
+	}
+	if f, override := rp.lookup(KindVault, "foo"); f == nil || !override {
+		t.Fatal("expected foo override for vault")
+	}
+	if f, _ := rp.lookup(KindVault, "bar"); f != nil {
+		t.Fatal("expected no retry func for vault on bar")
+	}
+}
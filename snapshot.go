@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"sort"
+	"time"
+)
+
+// Snapshot is a point in time copy of the Watcher's state, returned by
+// Watcher.Snapshot. It is meant for introspection (eg. to serve as JSON from
+// an admin endpoint) and doesn't change with the Watcher.
+type Snapshot struct {
+	// Notifiers are the registered notifiers (templates), sorted by ID.
+	Notifiers []NotifierSnapshot
+	// Views are the watched dependencies, sorted by ID.
+	Views []ViewSnapshot
+}
+
+// NotifierSnapshot is a registered notifier (template) and its dependencies.
+type NotifierSnapshot struct {
+	ID string
+	// Dependencies are the IDs of the dependencies (views) the notifier
+	// uses, sorted.
+	Dependencies []string
+	// Complete is true once all the dependencies' data has been used, see
+	// Watcher.Complete.
+	Complete bool
+}
+
+// ViewSnapshot is the status of a watched dependency.
+type ViewSnapshot struct {
+	// ID is the dependency's ID.
+	ID string
+	// Kind is the dependency's kind, as used to pick its retry function.
+	Kind string
+	// Notifiers are the IDs of the notifiers using the dependency, sorted.
+	Notifiers []string
+	// LastIndex is the index of the last data received.
+	LastIndex uint64
+	// LastFetch is the time of the last successful fetch, zero if there
+	// hasn't been one.
+	LastFetch time.Time
+	// Errors is the number of failed fetches and LastError the most recent
+	// one's message.
+	Errors    int
+	LastError string
+	// Fetches is the number of successful fetches and QueryBackend the
+	// Consul backend ("streaming" or "blocking-query") that served the last
+	// one, if reported. Comparing them shows the load streaming saves.
+	Fetches      int
+	QueryBackend string
+	// DegradedSince is when the dependency started serving its last data
+	// despite failing past its retries, zero unless it is degraded.
+	DegradedSince time.Time
+	// Polling is true while the dependency is being watched.
+	Polling bool
+	// ReceivedData is true once data has been received.
+	ReceivedData bool
+}
+
+// Snapshot returns the notifiers with their dependencies and the status of
+// the watched dependencies. This can be used to see which templates are
+// blocked on which dependencies.
+func (w *Watcher) Snapshot() Snapshot {
+	notifiers, views := w.tracker.snapshot()
+
+	snap := Snapshot{
+		Notifiers: notifiers,
+		Views:     make([]ViewSnapshot, 0, len(views)),
+	}
+	for _, v := range views {
+		snap.Views = append(snap.Views, v.view.snapshot(v.notifiers))
+	}
+	sort.Slice(snap.Views, func(i, j int) bool {
+		return snap.Views[i].ID < snap.Views[j].ID
+	})
+	return snap
+}
+
+// trackedView is a view with the IDs of the notifiers using it.
+type trackedView struct {
+	view      *view
+	notifiers []string
+}
+
+// snapshot returns the notifiers (sorted by ID) and the views with their
+// notifiers. The views' state isn't read under the tracker's lock.
+func (t *tracker) snapshot() ([]NotifierSnapshot, []trackedView) {
+	t.Lock()
+	defer t.Unlock()
+
+	deps := make(map[string][]string, len(t.notifiers))
+	complete := make(map[string]bool, len(t.notifiers))
+	for id := range t.notifiers {
+		deps[id] = []string{}
+		complete[id] = true
+	}
+	for id := range deps {
+		for viewID, tp := range t.byNotifier[id] {
+			deps[id] = append(deps[id], viewID)
+			complete[id] = complete[id] && tp.cacheAccessed
+		}
+	}
+
+	notifiers := make([]NotifierSnapshot, 0, len(deps))
+	for id, ds := range deps {
+		sort.Strings(ds)
+		notifiers = append(notifiers, NotifierSnapshot{
+			ID:           id,
+			Dependencies: ds,
+			Complete:     complete[id],
+		})
+	}
+	sort.Slice(notifiers, func(i, j int) bool {
+		return notifiers[i].ID < notifiers[j].ID
+	})
+
+	views := make([]trackedView, 0, len(t.views))
+	for id, v := range t.views {
+		ns := make([]string, 0, len(t.byView[id]))
+		for notifierID := range t.byView[id] {
+			ns = append(ns, notifierID)
+		}
+		sort.Strings(ns)
+		views = append(views, trackedView{view: v, notifiers: ns})
+	}
+	return notifiers, views
+}
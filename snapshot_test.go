@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestWatcherSnapshot(t *testing.T) {
+	w := newWatcher(2)
+	defer w.Stop()
+
+	foo, bar := fakeNotifier("foo"), fakeNotifier("bar")
+	w.Register(foo, bar, fakeNotifier("unused"))
+	depA := &idep.FakeDep{Name: "a"}
+	depB := &idep.FakeDep{Name: "b"}
+	w.Track(foo, depA)
+	w.Track(foo, depB)
+	w.Track(bar, depA)
+	w.Poll(depA)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := w.Snapshot()
+
+	expNotifiers := []NotifierSnapshot{
+		{ID: "bar", Dependencies: []string{depA.ID()}},
+		{ID: "foo", Dependencies: []string{depA.ID(), depB.ID()}},
+		{ID: "unused", Dependencies: []string{}, Complete: true},
+	}
+	if !reflect.DeepEqual(expNotifiers, snap.Notifiers) {
+		t.Errorf("bad notifiers\nexp: %+v\nact: %+v", expNotifiers, snap.Notifiers)
+	}
+
+	if len(snap.Views) != 2 {
+		t.Fatalf("expected 2 views, got %+v", snap.Views)
+	}
+	a, b := snap.Views[0], snap.Views[1]
+	if a.ID != depA.ID() || !reflect.DeepEqual([]string{"bar", "foo"}, a.Notifiers) {
+		t.Errorf("bad view a: %+v", a)
+	}
+	if !a.ReceivedData || a.LastIndex != 1 || a.LastFetch.IsZero() ||
+		a.Kind != string(KindConsul) {
+		t.Errorf("view a should have data: %+v", a)
+	}
+	if b.ID != depB.ID() || b.ReceivedData || b.Polling || !b.LastFetch.IsZero() {
+		t.Errorf("view b shouldn't have been fetched: %+v", b)
+	}
+
+	if _, err := json.Marshal(snap); err != nil {
+		t.Errorf("snapshot should serialize to JSON: %s", err)
+	}
+}
+
+func TestViewSnapshotErrors(t *testing.T) {
+	vw := newView(&newViewInput{
+		Dependency: &idep.FakeDepFetchError{Name: "foo"},
+		RetryFunc: func(retry int) (bool, time.Duration) {
+			return retry < 1, time.Millisecond
+		},
+	})
+	defer vw.stop()
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+	go vw.poll(viewCh, errCh)
+
+	select {
+	case <-errCh:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	snap := vw.snapshot(nil)
+	if snap.Errors != 2 || snap.LastError == "" || snap.ReceivedData {
+		t.Errorf("bad view snapshot: %+v", snap)
+	}
+}
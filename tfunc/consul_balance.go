@@ -0,0 +1,180 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tfunc
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+)
+
+// sortServices returns a copy of the services sorted by the given field. The
+// field is one of "id", "name", "node", "address" or "port", or "meta:<key>"
+// to sort by a ServiceMeta value. Like byMeta, a "|int" suffix on the meta key
+// sorts the values as numbers (missing values sort as 0). The sort is stable,
+// so services with the same value keep their order.
+//
+//	{{ range service "web" | sortServices "meta:zone" }}...{{ end }}
+func sortServices(field string, services []*dep.HealthService) ([]*dep.HealthService, error) {
+	var less func(a, b *dep.HealthService) (bool, error)
+	switch field {
+	case "id":
+		less = func(a, b *dep.HealthService) (bool, error) { return a.ID < b.ID, nil }
+	case "name":
+		less = func(a, b *dep.HealthService) (bool, error) { return a.Name < b.Name, nil }
+	case "node":
+		less = func(a, b *dep.HealthService) (bool, error) { return a.Node < b.Node, nil }
+	case "address":
+		less = func(a, b *dep.HealthService) (bool, error) { return a.Address < b.Address, nil }
+	case "port":
+		less = func(a, b *dep.HealthService) (bool, error) { return a.Port < b.Port, nil }
+	default:
+		key := strings.TrimPrefix(field, "meta:")
+		if key == field || key == "" {
+			return nil, fmt.Errorf("sortServices: invalid field %q", field)
+		}
+		less = func(a, b *dep.HealthService) (bool, error) {
+			return a.ServiceMeta[key] < b.ServiceMeta[key], nil
+		}
+		if realKey := strings.TrimSuffix(key, "|int"); realKey != key {
+			less = func(a, b *dep.HealthService) (bool, error) {
+				x, err := metaInt(a, realKey)
+				if err != nil {
+					return false, err
+				}
+				y, err := metaInt(b, realKey)
+				if err != nil {
+					return false, err
+				}
+				return x < y, nil
+			}
+		}
+	}
+
+	sorted := make([]*dep.HealthService, len(services))
+	copy(sorted, services)
+
+	var err error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		l, lerr := less(sorted[i], sorted[j])
+		if lerr != nil && err == nil {
+			err = lerr
+		}
+		return l
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sortServices: %s", err)
+	}
+	return sorted, nil
+}
+
+// metaInt returns the ServiceMeta value as a number, 0 if it is missing.
+func metaInt(s *dep.HealthService, key string) (int, error) {
+	v, ok := s.ServiceMeta[key]
+	if !ok || v == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %v as number", v)
+	}
+	return i, nil
+}
+
+// expandByWeight returns the services with each one repeated by its weight
+// for its health status, Weights.Passing for passing and Weights.Warning for
+// warning. Services with other statuses are dropped. Services without weights
+// default to a weight of 1, like in Consul. This is for load balancers that
+// take weighted upstreams as a list of (repeated) servers.
+//
+//	{{ range service "web" | expandByWeight }}server {{ .Address }}{{ end }}
+func expandByWeight(services []*dep.HealthService) []*dep.HealthService {
+	var expanded []*dep.HealthService
+	for _, s := range services {
+		weights := s.Weights
+		if weights == (api.AgentWeights{}) {
+			weights = api.AgentWeights{Passing: 1, Warning: 1}
+		}
+
+		var n int
+		switch s.Status {
+		case api.HealthPassing:
+			n = weights.Passing
+		case api.HealthWarning:
+			n = weights.Warning
+		}
+		for i := 0; i < n; i++ {
+			expanded = append(expanded, s)
+		}
+	}
+	return expanded
+}
+
+// shard splits the services into count shards by a hash of their node and ID
+// and returns the ones in the shard with the index (0 to count-1). Services
+// stay in the same shard as others come and go.
+//
+//	{{ range service "web" | shard 0 3 }}...{{ end }}
+func shard(index, count int, services []*dep.HealthService) ([]*dep.HealthService, error) {
+	if count < 1 || index < 0 || index >= count {
+		return nil, fmt.Errorf("shard: invalid shard %d of %d", index, count)
+	}
+
+	var result []*dep.HealthService
+	for _, s := range services {
+		if serviceHash("", s)%uint64(count) == uint64(index) {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// hashSelect picks n of the services for the key (eg. the consumer's node
+// name) using rendezvous hashing. Each key gets a stable subset of the
+// services, which changes minimally as services come and go. The services
+// are returned in order of preference.
+//
+//	{{ range service "web" | hashSelect (env "NODE") 2 }}...{{ end }}
+func hashSelect(key string, n int, services []*dep.HealthService) ([]*dep.HealthService, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("hashSelect: invalid count %d", n)
+	}
+
+	type scored struct {
+		score   uint64
+		service *dep.HealthService
+	}
+	all := make([]scored, 0, len(services))
+	for _, s := range services {
+		all = append(all, scored{score: serviceHash(key, s), service: s})
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].score > all[j].score
+	})
+
+	if n > len(all) {
+		n = len(all)
+	}
+	result := make([]*dep.HealthService, 0, n)
+	for _, s := range all[:n] {
+		result = append(result, s.service)
+	}
+	return result, nil
+}
+
+// serviceHash hashes the key with the service instance (node and ID).
+func serviceHash(key string, s *dep.HealthService) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(s.Node))
+	h.Write([]byte{0})
+	h.Write([]byte(s.ID))
+	return h.Sum64()
+}
@@ -0,0 +1,267 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tfunc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat"
+	"github.com/hashicorp/hcat/dep"
+)
+
+func serviceIDs(services []*dep.HealthService) []string {
+	ids := []string{}
+	for _, s := range services {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func Test_sortServices(t *testing.T) {
+	t.Parallel()
+
+	services := []*dep.HealthService{
+		{ID: "a", Node: "n2", Address: "10.0.0.2", Port: 81,
+			ServiceMeta: map[string]string{"zone": "b", "rank": "10"}},
+		{ID: "b", Node: "n1", Address: "10.0.0.3", Port: 80,
+			ServiceMeta: map[string]string{"zone": "a", "rank": "9"}},
+		{ID: "c", Node: "n3", Address: "10.0.0.1", Port: 80,
+			ServiceMeta: map[string]string{"zone": "b"}},
+	}
+
+	cases := []struct {
+		field string
+		exp   []string
+		err   bool
+	}{
+		{"id", []string{"a", "b", "c"}, false},
+		{"node", []string{"b", "a", "c"}, false},
+		{"address", []string{"c", "a", "b"}, false},
+		{"port", []string{"b", "c", "a"}, false},
+		{"meta:zone", []string{"b", "a", "c"}, false},
+		{"meta:rank", []string{"c", "a", "b"}, false},
+		{"meta:rank|int", []string{"c", "b", "a"}, false},
+		{"meta:", nil, true},
+		{"bogus", nil, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.field, func(t *testing.T) {
+			act, err := sortServices(tc.field, services)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if tc.err {
+				return
+			}
+			if ids := serviceIDs(act); !reflect.DeepEqual(tc.exp, ids) {
+				t.Errorf("\nexp: %v\nact: %v", tc.exp, ids)
+			}
+		})
+	}
+
+	t.Run("bad_int", func(t *testing.T) {
+		_, err := sortServices("meta:zone|int", services)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		sortServices("address", services)
+		if ids := serviceIDs(services); !reflect.DeepEqual(
+			[]string{"a", "b", "c"}, ids) {
+			t.Errorf("input modified: %v", ids)
+		}
+	})
+}
+
+func Test_expandByWeight(t *testing.T) {
+	t.Parallel()
+
+	services := []*dep.HealthService{
+		{ID: "a", Status: api.HealthPassing,
+			Weights: api.AgentWeights{Passing: 3, Warning: 1}},
+		{ID: "b", Status: api.HealthWarning,
+			Weights: api.AgentWeights{Passing: 3, Warning: 2}},
+		{ID: "c", Status: api.HealthPassing},
+		{ID: "d", Status: api.HealthCritical},
+		{ID: "e", Status: api.HealthPassing,
+			Weights: api.AgentWeights{Passing: 0, Warning: 1}},
+	}
+
+	exp := []string{"a", "a", "a", "b", "b", "c"}
+	if ids := serviceIDs(expandByWeight(services)); !reflect.DeepEqual(exp, ids) {
+		t.Errorf("\nexp: %v\nact: %v", exp, ids)
+	}
+}
+
+func testServices(n int) []*dep.HealthService {
+	services := make([]*dep.HealthService, 0, n)
+	for i := 0; i < n; i++ {
+		services = append(services, &dep.HealthService{
+			ID:   fmt.Sprintf("web-%d", i),
+			Node: fmt.Sprintf("node-%d", i),
+		})
+	}
+	return services
+}
+
+func Test_shard(t *testing.T) {
+	t.Parallel()
+
+	services := testServices(30)
+	seen := map[string]int{}
+	for i := 0; i < 3; i++ {
+		act, err := shard(i, 3, services)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range act {
+			seen[s.ID]++
+		}
+	}
+	if len(seen) != len(services) {
+		t.Errorf("expected all %d services sharded, got %d",
+			len(services), len(seen))
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("service %s in %d shards", id, n)
+		}
+	}
+
+	// services stay in their shard when others are removed
+	first, _ := shard(1, 3, services)
+	rest, _ := shard(1, 3, services[1:])
+	var exp []*dep.HealthService
+	for _, s := range first {
+		if s.ID != "web-0" {
+			exp = append(exp, s)
+		}
+	}
+	if !reflect.DeepEqual(serviceIDs(exp), serviceIDs(rest)) {
+		t.Errorf("shard changed: %v vs %v", serviceIDs(exp), serviceIDs(rest))
+	}
+
+	for _, args := range [][2]int{{0, 0}, {3, 3}, {-1, 2}} {
+		if _, err := shard(args[0], args[1], services); err == nil {
+			t.Errorf("expected error for shard %d of %d", args[0], args[1])
+		}
+	}
+}
+
+func Test_hashSelect(t *testing.T) {
+	t.Parallel()
+
+	services := testServices(10)
+
+	a, err := hashSelect("consumer-a", 3, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 3 {
+		t.Fatalf("expected 3 services, got %d", len(a))
+	}
+
+	// stable for the same key, regardless of the input order
+	reversed := make([]*dep.HealthService, 0, len(services))
+	for i := len(services) - 1; i >= 0; i-- {
+		reversed = append(reversed, services[i])
+	}
+	again, _ := hashSelect("consumer-a", 3, reversed)
+	if !reflect.DeepEqual(serviceIDs(a), serviceIDs(again)) {
+		t.Errorf("selection not stable: %v vs %v",
+			serviceIDs(a), serviceIDs(again))
+	}
+
+	// removing an unselected service doesn't change the selection
+	var without []*dep.HealthService
+	removed := false
+	for _, s := range services {
+		if !removed && !containsID(a, s.ID) {
+			removed = true
+			continue
+		}
+		without = append(without, s)
+	}
+	after, _ := hashSelect("consumer-a", 3, without)
+	if !reflect.DeepEqual(serviceIDs(a), serviceIDs(after)) {
+		t.Errorf("selection changed: %v vs %v", serviceIDs(a), serviceIDs(after))
+	}
+
+	all, _ := hashSelect("consumer-a", 20, services)
+	if len(all) != len(services) {
+		t.Errorf("expected all services, got %d", len(all))
+	}
+	if _, err := hashSelect("consumer-a", -1, services); err == nil {
+		t.Error("expected error for negative count")
+	}
+}
+
+func containsID(services []*dep.HealthService, id string) bool {
+	for _, s := range services {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestConsulBalanceExecute(t *testing.T) {
+	t.Parallel()
+
+	st := hcat.NewStore()
+	st.Save(testHealthServiceQueryID("webapp"), []*dep.HealthService{
+		{ID: "b", Address: "5.6.7.8", Status: api.HealthPassing,
+			Weights: api.AgentWeights{Passing: 2, Warning: 1}},
+		{ID: "a", Address: "1.2.3.4", Status: api.HealthPassing,
+			Weights: api.AgentWeights{Passing: 1, Warning: 1}},
+	})
+	w := fakeWatcher{st}
+
+	cases := []struct {
+		name     string
+		contents string
+		exp      string
+	}{
+		{
+			"sort_services",
+			`{{ range service "webapp" | sortServices "address" }}{{ .ID }}{{ end }}`,
+			"ab",
+		},
+		{
+			"expand_by_weight",
+			`{{ range service "webapp" | expandByWeight }}{{ .Address }} {{ end }}`,
+			"5.6.7.8 5.6.7.8 1.2.3.4 ",
+		},
+		{
+			"hash_select",
+			`{{ range service "webapp" | hashSelect "node" 5 }}x{{ end }}`,
+			"xx",
+		},
+		{
+			"shard",
+			`{{ len (service "webapp" | shard 0 1) }}`,
+			"2",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			tpl := newTemplate(hcat.TemplateInput{Contents: tc.contents})
+			a, err := tpl.Execute(w.Recaller(tpl))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte(tc.exp), a) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.exp, string(a))
+			}
+		})
+	}
+}
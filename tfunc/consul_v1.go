@@ -19,13 +19,15 @@ var errFuncNotImplemented = fmt.Errorf("function is not implemented")
 // namespaces.
 func FuncMapConsulV1() template.FuncMap {
 	return template.FuncMap{
-		"service":      v1ServiceFunc,
-		"connect":      v1ConnectFunc,
-		"services":     v1ServicesFunc,
-		"keys":         v1KVListFunc,
-		"key":          v1KVGetFunc,
-		"keyExists":    v1KVExistsFunc,
-		"keyExistsGet": v1KVExistsGetFunc,
+		"service":         v1ServiceFunc,
+		"connect":         v1ConnectFunc,
+		"services":        v1ServicesFunc,
+		"keys":            v1KVListFunc,
+		"key":             v1KVGetFunc,
+		"keyExists":       v1KVExistsFunc,
+		"keyExistsGet":    v1KVExistsGetFunc,
+		"gatewayServices": v1GatewayServicesFunc,
+		"preparedQuery":   v1PreparedQueryFunc,
 
 		// Set of Consul functions that are not yet implemented for v1. These
 		// intentionally error instead of defaulting to the v0 implementations
@@ -116,6 +118,59 @@ func v1ConnectFunc(recall hcat.Recaller) interface{} {
 	}
 }
 
+// v1PreparedQueryFunc executes a prepared query and returns the health
+// information of the resulting services. The endpoint does not support
+// blocking queries so it is polled.
+//
+// Endpoint: /v1/query/:query/execute
+// Template: {{ preparedQuery "queryName" <filter options> ... }}
+func v1PreparedQueryFunc(recall hcat.Recaller) interface{} {
+	return func(query string, opts ...string) ([]*dep.HealthService, error) {
+		result := []*dep.HealthService{}
+
+		if query == "" {
+			return result, nil
+		}
+
+		d, err := idep.NewPreparedQueryV1(query, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, ok := recall(d); ok {
+			return value.([]*dep.HealthService), nil
+		}
+
+		return result, nil
+	}
+}
+
+// v1GatewayServicesFunc returns the services linked to a terminating or
+// ingress gateway.
+//
+// Endpoint: /v1/catalog/gateway-services/:gateway
+// Template: {{ gatewayServices "gatewayName" <filter options> ... }}
+func v1GatewayServicesFunc(recall hcat.Recaller) interface{} {
+	return func(gateway string, opts ...string) ([]*dep.GatewayService, error) {
+		result := []*dep.GatewayService{}
+
+		if gateway == "" {
+			return result, nil
+		}
+
+		d, err := idep.NewCatalogGatewayServicesQueryV1(gateway, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, ok := recall(d); ok {
+			return value.([]*dep.GatewayService), nil
+		}
+
+		return result, nil
+	}
+}
+
 // v1KVListFunc returns list of key value pairs
 //
 // Endpoint: /v1/kv/:prefix?recurse
@@ -158,6 +158,58 @@ func TestTemplateExecuteConsulV1(t *testing.T) {
 			"[dc1 dc2]",
 			false,
 		},
+		{
+			"func_gateway_services",
+			hcat.TemplateInput{
+				Contents: `{{ range gatewayServices "gateway" "ns=namespace" }}{{ .Service.Name }}:{{ .Port }};{{ end }}`,
+			},
+			func() hcat.Watcherer {
+				st := hcat.NewStore()
+				d, err := idep.NewCatalogGatewayServicesQueryV1("gateway", []string{"ns=namespace"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				st.Save(d.ID(), []*dep.GatewayService{
+					{
+						Service: dep.GatewayServiceName{Name: "api"},
+						Port:    8080,
+					},
+					{
+						Service: dep.GatewayServiceName{Name: "web"},
+						Port:    8081,
+					},
+				})
+				return fakeWatcher{st}
+			}(),
+			"api:8080;web:8081;",
+			false,
+		},
+		{
+			"func_prepared_query",
+			hcat.TemplateInput{
+				Contents: `{{ range preparedQuery "webapp" "dc=dc1" }}{{ .Address }}{{ end }}`,
+			},
+			func() hcat.Watcherer {
+				st := hcat.NewStore()
+				d, err := idep.NewPreparedQueryV1("webapp", []string{"dc=dc1"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				st.Save(d.ID(), []*dep.HealthService{
+					{
+						Node:    "node1",
+						Address: "1.2.3.4",
+					},
+					{
+						Node:    "node2",
+						Address: "5.6.7.8",
+					},
+				})
+				return fakeWatcher{st}
+			}(),
+			"1.2.3.45.6.7.8",
+			false,
+		},
 		{
 			"func_keys",
 			hcat.TemplateInput{
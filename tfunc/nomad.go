@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tfunc
+
+import (
+	"github.com/hashicorp/hcat"
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// nomadVarFunc returns the items of a Nomad Variable.
+//
+// Endpoint: /v1/var/:path
+// Template: {{ nomadVar "path" <options> ... }}
+func nomadVarFunc(recall hcat.Recaller) interface{} {
+	return func(path string, opts ...string) (dep.NomadVarItems, error) {
+		result := dep.NomadVarItems{}
+
+		if path == "" {
+			return result, nil
+		}
+
+		d, err := idep.NewNomadVarGetQueryV1(path, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, ok := recall(d); ok {
+			return value.(dep.NomadVarItems), nil
+		}
+
+		return result, nil
+	}
+}
+
+// nomadVarListFunc returns the metadata of the Nomad Variables under a
+// prefix.
+//
+// Endpoint: /v1/vars?prefix=:prefix
+// Template: {{ nomadVarList "prefix" <filter options> ... }}
+func nomadVarListFunc(recall hcat.Recaller) interface{} {
+	return func(prefix string, opts ...string) ([]*dep.NomadVarMeta, error) {
+		result := []*dep.NomadVarMeta{}
+
+		d, err := idep.NewNomadVarListQueryV1(prefix, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, ok := recall(d); ok {
+			return value.([]*dep.NomadVarMeta), nil
+		}
+
+		return result, nil
+	}
+}
+
+// nomadServiceFunc returns the registrations of a Nomad service.
+//
+// Endpoint: /v1/service/:name
+// Template: {{ nomadService "name" <filter options> ... }}
+func nomadServiceFunc(recall hcat.Recaller) interface{} {
+	return func(name string, opts ...string) ([]*dep.NomadService, error) {
+		result := []*dep.NomadService{}
+
+		if name == "" {
+			return result, nil
+		}
+
+		d, err := idep.NewNomadServiceQueryV1(name, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, ok := recall(d); ok {
+			return value.([]*dep.NomadService), nil
+		}
+
+		return result, nil
+	}
+}
+
+// nomadServicesFunc returns the list of Nomad services.
+//
+// Endpoint: /v1/services
+// Template: {{ nomadServices <filter options> ... }}
+func nomadServicesFunc(recall hcat.Recaller) interface{} {
+	return func(opts ...string) ([]*dep.NomadServicesSnippet, error) {
+		result := []*dep.NomadServicesSnippet{}
+
+		d, err := idep.NewNomadServicesQueryV1(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, ok := recall(d); ok {
+			return value.([]*dep.NomadServicesSnippet), nil
+		}
+
+		return result, nil
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tfunc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat"
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestNomadExecute(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name string
+		ti   hcat.TemplateInput
+		i    hcat.Watcherer
+		e    string
+		err  bool
+	}
+
+	testFunc := func(tc testCase) func(*testing.T) {
+		return func(t *testing.T) {
+			tc.ti.FuncMapMerge = Nomad()
+			tpl := newTemplate(tc.ti)
+
+			a, err := tpl.Execute(tc.i.Recaller(tpl))
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if !bytes.Equal([]byte(tc.e), a) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.e, string(a))
+			}
+		}
+	}
+
+	cases := []testCase{
+		{
+			"func_nomad_var",
+			hcat.TemplateInput{
+				Contents: `{{ with nomadVar "nomad/jobs/web" "ns=prod" }}{{ .user }}{{ end }}`,
+			},
+			func() hcat.Watcherer {
+				st := hcat.NewStore()
+				d, err := idep.NewNomadVarGetQueryV1("nomad/jobs/web",
+					[]string{"ns=prod"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				st.Save(d.ID(), dep.NomadVarItems{"user": "admin"})
+				return fakeWatcher{st}
+			}(),
+			"admin",
+			false,
+		},
+		{
+			"func_nomad_var_filter_error",
+			hcat.TemplateInput{
+				Contents: `{{ nomadVar "nomad/jobs/web" "Path == foo" }}`,
+			},
+			fakeWatcher{hcat.NewStore()},
+			"",
+			true,
+		},
+		{
+			"func_nomad_var_list",
+			hcat.TemplateInput{
+				Contents: `{{ range nomadVarList "nomad/jobs" }}{{ .Path }} {{ end }}`,
+			},
+			func() hcat.Watcherer {
+				st := hcat.NewStore()
+				d, err := idep.NewNomadVarListQueryV1("nomad/jobs", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				st.Save(d.ID(), []*dep.NomadVarMeta{
+					{Path: "nomad/jobs/api"},
+					{Path: "nomad/jobs/web"},
+				})
+				return fakeWatcher{st}
+			}(),
+			"nomad/jobs/api nomad/jobs/web ",
+			false,
+		},
+		{
+			"func_nomad_service",
+			hcat.TemplateInput{
+				Contents: `{{ range nomadService "web" "region=eu" }}{{ .Address }}:{{ .Port }} {{ end }}`,
+			},
+			func() hcat.Watcherer {
+				st := hcat.NewStore()
+				d, err := idep.NewNomadServiceQueryV1("web",
+					[]string{"region=eu"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				st.Save(d.ID(), []*dep.NomadService{
+					{Name: "web", Address: "1.2.3.4", Port: 8080},
+					{Name: "web", Address: "5.6.7.8", Port: 8080},
+				})
+				return fakeWatcher{st}
+			}(),
+			"1.2.3.4:8080 5.6.7.8:8080 ",
+			false,
+		},
+		{
+			"func_nomad_services",
+			hcat.TemplateInput{
+				Contents: `{{ range nomadServices }}{{ .Name }} {{ end }}`,
+			},
+			func() hcat.Watcherer {
+				st := hcat.NewStore()
+				d, err := idep.NewNomadServicesQueryV1(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				st.Save(d.ID(), []*dep.NomadServicesSnippet{
+					{Name: "api"},
+					{Name: "web"},
+				})
+				return fakeWatcher{st}
+			}(),
+			"api web ",
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), testFunc(tc))
+	}
+}
+
+// fakeNomad returns a fake Nomad HTTP API server. Blocking queries for the
+// current index are held until the request is cancelled.
+func fakeNomad(t *testing.T) *httptest.Server {
+	routes := map[string]string{
+		"/v1/var/nomad/jobs/web": `{"Path": "nomad/jobs/web",
+			"Items": {"user": "admin"}}`,
+		"/v1/vars": `[{"Path": "nomad/jobs/web"}, {"Path": "nomad/jobs/api"}]`,
+		"/v1/service/web": `[
+			{"ID": "b", "ServiceName": "web", "Address": "5.6.7.8", "Port": 80},
+			{"ID": "a", "ServiceName": "web", "Address": "1.2.3.4", "Port": 80}]`,
+		"/v1/services": `[{"Namespace": "default", "Services": [
+			{"ServiceName": "web", "Tags": ["b", "a"]},
+			{"ServiceName": "api"}]}]`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, ok := routes[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			if r.URL.Query().Get("index") == "1" {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			}
+			w.Header().Set("X-Nomad-Index", "1")
+			fmt.Fprint(w, body)
+		}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestNomadWatch(t *testing.T) {
+	t.Parallel()
+
+	ts := fakeNomad(t)
+	clients := hcat.NewClientSet()
+	if err := clients.AddNomad(hcat.NomadInput{Address: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+	w := hcat.NewWatcher(hcat.WatcherInput{
+		Clients: clients,
+		Cache:   hcat.NewStore(),
+	})
+	defer w.Stop()
+
+	tmpl := hcat.NewTemplate(hcat.TemplateInput{
+		Contents: `{{ with nomadVar "nomad/jobs/web" }}{{ .user }}{{ end }}
+{{ range nomadVarList "nomad/jobs" }}{{ .Path }} {{ end }}
+{{ range nomadService "web" }}{{ .Address }} {{ end }}
+{{ range nomadServices }}{{ .Name }}{{ .Tags }} {{ end }}`,
+		FuncMapMerge: Nomad(),
+	})
+	w.Register(tmpl)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r := hcat.NewResolver()
+	for {
+		re, err := r.Run(tmpl, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if re.Complete {
+			exp := "admin\nnomad/jobs/api nomad/jobs/web \n" +
+				"1.2.3.4 5.6.7.8 \napi[] web[a b] "
+			if act := string(re.Contents); act != exp {
+				t.Fatalf("\nexp: %#v\nact: %#v", exp, act)
+			}
+			return
+		}
+		if err := w.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if ctx.Err() != nil {
+			t.Fatal("timeout")
+		}
+	}
+}
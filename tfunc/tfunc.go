@@ -47,13 +47,15 @@ func ConsulV0() template.FuncMap {
 // namespaces.
 func ConsulV1() template.FuncMap {
 	return template.FuncMap{
-		"service":      v1ServiceFunc,
-		"connect":      v1ConnectFunc,
-		"services":     v1ServicesFunc,
-		"keys":         v1KVListFunc,
-		"key":          v1KVGetFunc,
-		"keyExists":    v1KVExistsFunc,
-		"keyExistsGet": v1KVExistsGetFunc,
+		"service":         v1ServiceFunc,
+		"connect":         v1ConnectFunc,
+		"services":        v1ServicesFunc,
+		"keys":            v1KVListFunc,
+		"key":             v1KVGetFunc,
+		"keyExists":       v1KVExistsFunc,
+		"keyExistsGet":    v1KVExistsGetFunc,
+		"gatewayServices": v1GatewayServicesFunc,
+		"preparedQuery":   v1PreparedQueryFunc,
 
 		// Set of Consul functions that are not yet implemented for v1. These
 		// intentionally error instead of defaulting to the v0 implementations
@@ -69,6 +71,11 @@ func ConsulFilters() template.FuncMap {
 		"byKey":  byKey,
 		"byTag":  byTag,
 		"byMeta": byMeta,
+		// Sorting and load balancing
+		"sortServices":   sortServices,
+		"expandByWeight": expandByWeight,
+		"shard":          shard,
+		"hashSelect":     hashSelect,
 	}
 }
 
@@ -80,6 +87,17 @@ func VaultV0() template.FuncMap {
 	}
 }
 
+// Nomad querying functions. The functions support Nomad filter expressions
+// and use the "nomad" client (see hcat.ClientSet.AddNomad).
+func Nomad() template.FuncMap {
+	return template.FuncMap{
+		"nomadVar":      nomadVarFunc,
+		"nomadVarList":  nomadVarListFunc,
+		"nomadService":  nomadServiceFunc,
+		"nomadServices": nomadServicesFunc,
+	}
+}
+
 // Environment variable querying functions
 func Env() template.FuncMap {
 	return template.FuncMap{
@@ -5,13 +5,11 @@ package hcat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"reflect"
-	"regexp"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -20,13 +18,10 @@ import (
 	idep "github.com/hashicorp/hcat/internal/dependency"
 )
 
-var regexUnexpectedResponseCode = regexp.MustCompile("Unexpected response code: ([0-9]{3})")
-
-// Temporarily raise these types to the top level via aliasing.
-// This is to address a bug in the short term and this should be refactored
-// when thinking of how to modularlize the dependencies.
-type QueryOptionsSetter = idep.QueryOptionsSetter
-type QueryOptions = idep.QueryOptions
+// Raise these types to the top level via aliasing for backwards
+// compatibility, they are defined in the public dep package.
+type QueryOptionsSetter = dep.QueryOptionsSetter
+type QueryOptions = dep.QueryOptions
 
 // view is a representation of a Dependency and the most recent data it has
 // received from Consul.
@@ -51,6 +46,26 @@ type view struct {
 	// flag to denote that polling is active
 	isPolling bool
 
+	// lastFetch is the time of the last successful fetch, errors the count
+	// of failed ones and lastError the last failure, for Watcher.Snapshot
+	lastFetch time.Time
+	errors    int
+	lastError string
+	// fetches counts the successful fetches and queryBackend is the Consul
+	// backend that served the last one, if reported
+	fetches      int
+	queryBackend string
+	// degradedSince is set while the view serves its last data despite
+	// having exhausted its retries
+	degradedSince time.Time
+
+	// shared is the pool's view polling for this one, nil if not shared
+	shared *sharedView
+
+	// retrying is set by poll when it restarts fetch after an error, so the
+	// retry sleep isn't followed by a polling wait
+	retrying bool
+
 	// blockWaitTime is amount of time in seconds to do a blocking query for
 	blockWaitTime time.Duration
 
@@ -60,9 +75,38 @@ type view struct {
 	// defaultLease is used for non-renewable leases when secret has no lease
 	defaultLease time.Duration
 
+	// pollingWait overrides the time to wait between fetches for dependencies
+	// that don't support blocking queries
+	pollingWait time.Duration
+
+	// useStreaming asks for Consul's streaming backend
+	useStreaming bool
+
+	// useCache, maxAge and staleIfError ask for the Consul agent cache
+	useCache     bool
+	maxAge       time.Duration
+	staleIfError time.Duration
+
 	// retryFunc is the function to invoke on failure to determine if a retry
 	// should be attempted.
 	retryFunc RetryFunc
+	// throttleFunc gives the sleep before retrying a rate limited query
+	throttleFunc RetryFunc
+	// maxDegraded is how long after its last successful fetch the view keeps
+	// serving its data once its retries are exhausted, 0 to not degrade, and
+	// degradedFunc gives the sleep between the retries meanwhile
+	maxDegraded  time.Duration
+	degradedFunc RetryFunc
+	// retryKind and retryNotifier describe where the retry function came
+	// from, for reporting in events.
+	retryKind     string
+	retryNotifier string
+
+	// limiter caps the watcher's queries in flight, nil for no limit
+	limiter *queryLimiter
+
+	// goroutines counts the watcher's running goroutines, for Shutdown
+	goroutines *goroutines
 
 	// stopCh is used to stop polling on this view
 	stopCh chan struct{}
@@ -98,9 +142,36 @@ type newViewInput struct {
 	// RetryFunc is a function which dictates how this view should retry on
 	// upstream errors.
 	RetryFunc RetryFunc
+	// RetryKind is the dependency kind used to pick the RetryFunc.
+	RetryKind string
+	// RetryNotifier is the ID of the notifier that overrode the RetryFunc,
+	// empty if the watcher's default was used.
+	RetryNotifier string
+	// MaxDegraded is how long the view keeps serving its last data once its
+	// retries are exhausted, 0 to push the error up instead.
+	MaxDegraded time.Duration
 
 	// Default non-renewable secret duration
 	VaultDefaultLease time.Duration
+
+	// PollingWait overrides the time to wait between fetches for dependencies
+	// that don't support blocking queries.
+	PollingWait time.Duration
+
+	// Limiter caps the queries in flight, shared by the watcher's views.
+	Limiter *queryLimiter
+
+	// Goroutines counts the fetch goroutines, along the watcher's others.
+	Goroutines *goroutines
+
+	// UseStreaming asks for Consul's streaming backend.
+	UseStreaming bool
+
+	// UseCache asks for the Consul agent cache, MaxAge and StaleIfError
+	// limit the age of the cached responses.
+	UseCache     bool
+	MaxAge       time.Duration
+	StaleIfError time.Duration
 }
 
 // NewView constructs a new view with the given inputs.
@@ -117,13 +188,45 @@ func newView(i *newViewInput) *view {
 		blockWaitTime: i.BlockWaitTime,
 		maxStale:      i.MaxStale,
 		retryFunc:     i.RetryFunc,
+		throttleFunc:  throttleBackoff,
+		maxDegraded:   i.MaxDegraded,
+		degradedFunc:  degradedBackoff,
+		retryKind:     i.RetryKind,
+		retryNotifier: i.RetryNotifier,
 		stopCh:        make(chan struct{}, 1),
 		ctx:           ctx,
 		ctxCancel:     cancel,
 		defaultLease:  i.VaultDefaultLease,
+		pollingWait:   i.PollingWait,
+		limiter:       i.Limiter,
+		goroutines:    i.Goroutines,
+		useStreaming:  i.UseStreaming,
+		useCache:      i.UseCache,
+		maxAge:        i.MaxAge,
+		staleIfError:  i.StaleIfError,
 	}
 }
 
+// reconfigure applies the input's settings, they are used from the next
+// fetch on. The dependency, event handler, limiter and goroutines are kept.
+func (v *view) reconfigure(i *newViewInput) {
+	v.dataLock.Lock()
+	defer v.dataLock.Unlock()
+	v.clients = i.Clients
+	v.blockWaitTime = i.BlockWaitTime
+	v.maxStale = i.MaxStale
+	v.retryFunc = i.RetryFunc
+	v.retryKind = i.RetryKind
+	v.retryNotifier = i.RetryNotifier
+	v.maxDegraded = i.MaxDegraded
+	v.defaultLease = i.VaultDefaultLease
+	v.pollingWait = i.PollingWait
+	v.useStreaming = i.UseStreaming
+	v.useCache = i.UseCache
+	v.maxAge = i.MaxAge
+	v.staleIfError = i.StaleIfError
+}
+
 // Dependency returns the dependency attached to this view.
 func (v *view) Dependency() dep.Dependency {
 	return v.dependency
@@ -145,6 +248,26 @@ func (v *view) DataAndLastIndex() (interface{}, uint64) {
 	return v.data, v.lastIndex
 }
 
+// snapshot returns the view's status for Watcher.Snapshot.
+func (v *view) snapshot(notifiers []string) ViewSnapshot {
+	v.dataLock.RLock()
+	defer v.dataLock.RUnlock()
+	return ViewSnapshot{
+		ID:            v.ID(),
+		Kind:          v.retryKind,
+		Notifiers:     notifiers,
+		LastIndex:     v.lastIndex,
+		LastFetch:     v.lastFetch,
+		Errors:        v.errors,
+		LastError:     v.lastError,
+		Fetches:       v.fetches,
+		QueryBackend:  v.queryBackend,
+		DegradedSince: v.degradedSince,
+		Polling:       v.isPolling,
+		ReceivedData:  v.receivedData,
+	}
+}
+
 // ID outputs a unique string identifier for the view
 // It is identical to it's contained Dependency ID.
 func (v *view) ID() string {
@@ -152,7 +275,8 @@ func (v *view) ID() string {
 }
 
 // pollingFlag handles setting and clearing the flag to indicate active polling
-// Returned function needs to be called (usually w/ defer) to clear the flag.
+// Returned function needs to be called (usually w/ defer) to clear the flag,
+// only its first call does.
 func (v *view) pollingFlag() (alreadyPolling bool, unflag func()) {
 	v.dataLock.Lock()
 	defer v.dataLock.Unlock()
@@ -162,10 +286,13 @@ func (v *view) pollingFlag() (alreadyPolling bool, unflag func()) {
 	}
 
 	v.isPolling = true
+	var once sync.Once
 	return false, func() {
-		v.dataLock.Lock()
-		defer v.dataLock.Unlock()
-		v.isPolling = false
+		once.Do(func() {
+			v.dataLock.Lock()
+			defer v.dataLock.Unlock()
+			v.isPolling = false
+		})
 	}
 }
 
@@ -174,7 +301,12 @@ func (v *view) pollingFlag() (alreadyPolling bool, unflag func()) {
 // function to be fired in a goroutine, but then halted even if the fetch
 // function is in the middle of a blocking query.
 func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
-	var retries int
+	if v.shared != nil {
+		v.pollShared(viewCh, errCh)
+		return
+	}
+
+	var retries, throttled, degraded int
 	v.event(events.TrackStart{ID: v.ID()})
 
 	alreadyPolling, stoppedPolling := v.pollingFlag()
@@ -185,19 +317,33 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 		stoppedPolling()
 		v.event(events.TrackStop{ID: v.ID()})
 	}()
+	// a poll returning on stop leaves its fetch behind, don't start another
+	select {
+	case <-v.stopCh:
+		return
+	default:
+	}
 
 	for {
 		doneCh := make(chan struct{}, 1)
 		successCh := make(chan struct{}, 1)
 		fetchErrCh := make(chan error, 1)
-		go v.fetch(doneCh, successCh, fetchErrCh)
+		fetched, ok := v.goroutines.start("fetch " + v.ID())
+		if !ok {
+			return // shutting down
+		}
+		go func() {
+			defer fetched()
+			v.fetch(doneCh, successCh, fetchErrCh)
+		}()
 
 	WAIT:
 		select {
 		case <-doneCh:
 			// Reset the retry to avoid exponentially incrementing retries when we
 			// have some successful requests
-			retries = 0
+			retries, throttled, degraded = 0, 0, 0
+			v.recover()
 
 			select {
 			case <-v.stopCh:
@@ -213,17 +359,50 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 			// it returns, the view is unchanged. We have to reset the counter
 			// retries, but not update the actual template.
 			v.event(events.ServerContacted{ID: v.ID()})
-			retries = 0
+			retries, throttled, degraded = 0, 0, 0
+			v.recover()
 			goto WAIT
 		case err := <-fetchErrCh:
-			v.event(events.ServerError{ID: v.ID(), Error: err})
-			var skipRetry bool
-			if strings.Contains(err.Error(), "Unexpected response code: 400") {
-				// 400 is not useful to retry
-				skipRetry = true
+			v.dataLock.RLock()
+			retryFunc, retryKind := v.retryFunc, v.retryKind
+			retryNotifier := v.retryNotifier
+			v.dataLock.RUnlock()
+			// A dependency's own FetchError may not set the ID or kind, the
+			// watcher needs the ID to route the error back to the view.
+			fe := *idep.NewFetchError(retryKind, v.ID(), err)
+			fetchErr := &fe
+			fetchErr.ID = v.ID()
+			if fetchErr.Kind == "" {
+				fetchErr.Kind = retryKind
 			}
 
-			if getResponseCodeFromError(err) == http.StatusInternalServerError {
+			// The server is asking to slow down, this isn't a failure so it
+			// backs off and retries without using up the retries.
+			if fetchErr.StatusCode == http.StatusTooManyRequests {
+				_, sleep := v.throttleFunc(throttled)
+				throttled++
+				v.event(events.Throttled{
+					ID:      v.ID(),
+					Error:   err,
+					Attempt: throttled,
+					Sleep:   sleep,
+				})
+				select {
+				case <-time.After(sleep):
+					v.retrying = true
+					continue
+				case <-v.stopCh:
+					return
+				}
+			}
+
+			v.event(events.ServerError{ID: v.ID(), Error: err})
+			v.dataLock.Lock()
+			v.errors++
+			v.lastError = err.Error()
+			v.dataLock.Unlock()
+
+			if fetchErr.StatusCode == http.StatusInternalServerError {
 				// This indicates that Consul may have restarted. If Consul
 				// restarted, the current lastIndex will be stale and cause the
 				// next blocking query to hang until the wait time expires. To
@@ -234,31 +413,58 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 				v.dataLock.Unlock()
 			}
 
-			if v.retryFunc != nil && !skipRetry {
-				retry, sleep := v.retryFunc(retries)
+			// Non-retryable errors (eg. 400 bad request) skip retrying, as do
+			// degraded views which retry below
+			if retryFunc != nil && fetchErr.Retryable && degraded == 0 {
+				retry, sleep := retryFunc(retries)
 				if retry {
 					v.event(events.RetryAttempt{
-						ID:      v.ID(),
-						Attempt: retries + 1,
-						Sleep:   sleep,
-						Error:   err,
+						ID:       v.ID(),
+						Attempt:  retries + 1,
+						Sleep:    sleep,
+						Error:    err,
+						Kind:     retryKind,
+						Notifier: retryNotifier,
 					})
 					select {
 					case <-time.After(sleep):
 						retries++
+						v.retrying = true
 						continue
 					case <-v.stopCh:
 						return
 					}
 				}
-				v.event(events.MaxRetries{ID: v.ID(), Count: retries})
+				v.event(events.MaxRetries{
+					ID:       v.ID(),
+					Count:    retries,
+					Kind:     retryKind,
+					Notifier: retryNotifier,
+				})
 			}
 
-			// Push the error back up to the watcher
+			// Keep serving the last data while retrying in the background
+			if fetchErr.Retryable {
+				if sleep, ok := v.degrade(err, degraded); ok {
+					select {
+					case <-time.After(sleep):
+						degraded++
+						v.retrying = true
+						continue
+					case <-v.stopCh:
+						return
+					}
+				}
+			}
+
+			// Push the error back up to the watcher, done polling so it can
+			// poll the view again on it
+			fetchErr.Attempts = retries + degraded
+			stoppedPolling()
 			select {
 			case <-v.stopCh:
 				return
-			case errCh <- err:
+			case errCh <- fetchErr:
 				return
 			}
 		case <-v.stopCh:
@@ -267,6 +473,47 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 	}
 }
 
+// degrade reports if the view can keep serving its last data after a failed
+// fetch and the time to sleep before the next retry, the attempt-th while
+// degraded. It can as long as its last successful fetch isn't older than
+// maxDegraded.
+func (v *view) degrade(err error, attempt int) (time.Duration, bool) {
+	v.dataLock.Lock()
+	remaining := v.maxDegraded - time.Since(v.lastFetch)
+	if v.maxDegraded <= 0 || !v.receivedData || remaining <= 0 {
+		v.degradedSince = time.Time{}
+		v.dataLock.Unlock()
+		return 0, false
+	}
+	entered := v.degradedSince.IsZero()
+	if entered {
+		v.degradedSince = time.Now()
+	}
+	lastFetch := v.lastFetch
+	v.dataLock.Unlock()
+
+	if entered {
+		v.event(events.Degraded{ID: v.ID(), Error: err, LastData: lastFetch})
+	}
+	_, sleep := v.degradedFunc(attempt)
+	if sleep > remaining {
+		sleep = remaining
+	}
+	return sleep, true
+}
+
+// recover leaves the degraded mode, if the view was in it.
+func (v *view) recover() {
+	v.dataLock.Lock()
+	since := v.degradedSince
+	v.degradedSince = time.Time{}
+	v.dataLock.Unlock()
+
+	if !since.IsZero() {
+		v.event(events.Recovered{ID: v.ID(), Duration: time.Since(since)})
+	}
+}
+
 // fetch queries the Consul instance for the attached dependency. This API
 // promises that either data will be written to doneCh or an error will be
 // written to errCh. It is designed to be run in a goroutine that selects the
@@ -275,10 +522,13 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 	v.event(events.Trace{ID: v.ID(), Message: "starting fetch"})
 
-	var allowStale bool
-	if v.maxStale != 0 {
-		allowStale = true
-	}
+	v.dataLock.RLock()
+	allowStale := v.maxStale != 0
+	v.dataLock.RUnlock()
+
+	// A retry after an error already slept in poll, skip the polling wait
+	skipPollingWait := v.retrying
+	v.retrying = false
 
 	for {
 		// If the view was stopped, short-circuit this loop. This prevents a bug
@@ -291,26 +541,59 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		default:
 		}
 
+		// Endpoints that don't support blocking queries are polled, only the
+		// first fetch (and retries) are immediate.
+		if d, ok := v.dependency.(idep.PollingQuery); ok && v.lastIndex != 0 &&
+			!skipPollingWait {
+			if wait := d.PollingWait(); wait > 0 {
+				v.event(events.PollingWait{ID: v.ID(), Duration: wait})
+				select {
+				case <-v.stopCh:
+					return
+				case <-v.ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+		}
+		skipPollingWait = false
+
 		start := time.Now() // for rateLimiter below
 
+		// the settings can be changed by reconfigure between fetches
+		v.dataLock.RLock()
+		clients, maxStale := v.clients, v.maxStale
+		opts := QueryOptions{
+			AllowStale:   allowStale,
+			WaitTime:     v.blockWaitTime,
+			WaitIndex:    v.lastIndex,
+			DefaultLease: v.defaultLease,
+			PollingWait:  v.pollingWait,
+			UseStreaming: v.useStreaming,
+			UseCache:     v.useCache,
+			MaxAge:       v.maxAge,
+			StaleIfError: v.staleIfError,
+		}
+		v.dataLock.RUnlock()
 		if d, ok := v.dependency.(QueryOptionsSetter); ok {
-			opts := QueryOptions{
-				AllowStale:   allowStale,
-				WaitTime:     v.blockWaitTime,
-				WaitIndex:    v.lastIndex,
-				DefaultLease: v.defaultLease,
-			}
 			opts = opts.SetContext(v.ctx)
 			d.SetOptions(opts)
 		}
+		queued := func(position int) {
+			v.event(events.QueryQueued{ID: v.ID(), Position: position})
+		}
+		if !v.limiter.acquire(v.ctx, queued) {
+			return // stopped while waiting
+		}
 		v.event(events.Trace{ID: v.ID(), Message: "fetching value"})
-		data, rm, err := v.dependency.Fetch(v.clients)
+		blocking := v.lastIndex != 0
+		data, rm, err := v.dependency.Fetch(clients)
+		v.limiter.release()
 		if err != nil {
 			switch {
-			case err == dep.ErrStopped:
+			case errors.Is(err, dep.ErrStopped):
 				v.event(events.Trace{ID: v.ID(), Message: err.Error()})
-			case strings.Contains(err.Error(), context.Canceled.Error()):
-				// This is a wrapped error so relying on string matching
+			case errors.Is(err, context.Canceled):
 				v.event(events.Trace{ID: v.ID(), Message: err.Error()})
 			default:
 				errCh <- err
@@ -328,18 +611,31 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		// trigger a data update (because we could continue below), but we need to
 		// inform the poller to reset the retry count.
 		v.event(events.Trace{ID: v.ID(), Message: "successful data response"})
+		v.dataLock.Lock()
+		v.lastFetch = time.Now()
+		v.fetches++
+		// the first query isn't blocking so it is never streamed
+		backendChanged := blocking && rm.QueryBackend != "" &&
+			rm.QueryBackend != v.queryBackend
+		if backendChanged {
+			v.queryBackend = rm.QueryBackend
+		}
+		v.dataLock.Unlock()
+		if backendChanged {
+			v.event(events.QueryBackend{ID: v.ID(), Backend: rm.QueryBackend})
+		}
 		select {
 		case successCh <- struct{}{}:
 		default:
 		}
 
-		if allowStale && rm.LastContact > v.maxStale {
+		if allowStale && rm.LastContact > maxStale {
 			allowStale = false
 			v.event(events.StaleData{ID: v.ID(), LastContant: rm.LastContact})
 			continue
 		}
 
-		if v.maxStale != 0 {
+		if maxStale != 0 {
 			allowStale = true
 		}
 
@@ -365,7 +661,8 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		v.lastIndex = rm.LastIndex
 
 		if v.receivedData && reflect.DeepEqual(data, v.data) {
-			v.event(events.NoNewData{ID: v.ID()})
+			v.event(events.NoNewData{ID: v.ID(),
+				CacheHit: rm.CacheHit, CacheAge: rm.CacheAge})
 			v.dataLock.Unlock()
 			continue
 		}
@@ -377,7 +674,8 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		}
 		v.dataLock.Unlock()
 
-		v.event(events.NewData{ID: v.ID(), Data: data})
+		v.event(events.NewData{ID: v.ID(), Data: data,
+			CacheHit: rm.CacheHit, CacheAge: rm.CacheAge})
 		v.store(data)
 
 		close(doneCh)
@@ -399,6 +697,26 @@ func (v *view) store(data interface{}) *view {
 
 const minDelayBetweenUpdates = time.Millisecond * 100
 
+// throttleBackoff gives the sleep before retrying a query the server rate
+// limited (HTTP 429).
+var throttleBackoff = WithJitter(ExponentialBackoff(BackoffInput{
+	Base: 500 * time.Millisecond,
+	Max:  time.Minute,
+}), 0.2)
+
+// degradedBackoff gives the sleep between the retries of a degraded view.
+var degradedBackoff = WithJitter(ExponentialBackoff(BackoffInput{
+	Base: time.Second,
+	Max:  time.Minute,
+}), 0.2)
+
+// repollBackoff gives the sleep before polling a failed view again when its
+// errors are isolated (see WatcherInput.IsolateErrors).
+var repollBackoff = WithJitter(ExponentialBackoff(BackoffInput{
+	Base: time.Second,
+	Max:  time.Minute,
+}), 0.2)
+
 // return a duration to sleep to limit the frequency of upstream calls
 func rateLimiter(start time.Time) time.Duration {
 	remaining := minDelayBetweenUpdates - time.Since(start)
@@ -409,28 +727,16 @@ func rateLimiter(start time.Time) time.Duration {
 	return 0
 }
 
-// stop halts polling of this view.
+// stop halts polling of this view. A shared view's dependency is stopped by
+// the pool once no longer used.
 func (v *view) stop() {
+	if v.shared != nil {
+		close(v.stopCh)
+		v.ctxCancel()
+		v.shared.pool.release(v.shared)
+		return
+	}
 	v.dependency.Stop()
 	close(v.stopCh)
 	v.ctxCancel()
 }
-
-func getResponseCodeFromError(err error) int {
-	// Extract the unexpected response substring
-	s := regexUnexpectedResponseCode.FindString(err.Error())
-	if s == "" {
-		return 0
-	}
-
-	// Extract the response code substring from the unexpected response substring
-	s = s[len(s)-3:]
-
-	// Convert the response code to an integer
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		return 0
-	}
-
-	return i
-}
@@ -5,12 +5,15 @@ package hcat
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	hdep "github.com/hashicorp/hcat/dep"
 	"github.com/hashicorp/hcat/events"
 	dep "github.com/hashicorp/hcat/internal/dependency"
 )
@@ -52,11 +55,21 @@ func TestPoll_returnsErrCh(t *testing.T) {
 	case data := <-viewCh:
 		t.Errorf("expected no data, but got %+v", data)
 	case err := <-errCh:
+		var fetchErr *hdep.FetchError
+		if !errors.As(err, &fetchErr) {
+			t.Fatalf("expected a FetchError, got %T", err)
+		}
 		expected := http.StatusInternalServerError
-		actual := getResponseCodeFromError(err)
+		actual := fetchErr.StatusCode
 		if actual != expected {
 			t.Errorf("expected status code %q to be %q", actual, expected)
 		}
+		if fetchErr.ID != vw.ID() {
+			t.Errorf("bad error ID: %s", fetchErr.ID)
+		}
+		if !fetchErr.Retryable {
+			t.Errorf("expected 500 to be retryable")
+		}
 		if vw.lastIndex != 0 {
 			t.Errorf("expected last index to be 0 but %q", vw.lastIndex)
 		}
@@ -118,6 +131,408 @@ func TestPoll_retries(t *testing.T) {
 	}
 }
 
+func TestPoll_noRetryBadRequest(t *testing.T) {
+	var retried bool
+	vw := newView(&newViewInput{
+		Dependency: &dep.FakeDepFetchError{Code: http.StatusBadRequest},
+		RetryFunc: func(retry int) (bool, time.Duration) {
+			retried = true
+			return true, time.Millisecond
+		},
+	})
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+
+	go vw.poll(viewCh, errCh)
+	defer vw.stop()
+
+	select {
+	case <-viewCh:
+		t.Errorf("expected no data")
+	case err := <-errCh:
+		var fetchErr *hdep.FetchError
+		if !errors.As(err, &fetchErr) {
+			t.Fatalf("expected a FetchError, got %T", err)
+		}
+		if fetchErr.Retryable {
+			t.Errorf("expected 400 to not be retryable")
+		}
+		if retried || fetchErr.Attempts != 0 {
+			t.Errorf("expected no retries")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+}
+
+func TestPoll_retryPermissionDenied(t *testing.T) {
+	vw := newView(&newViewInput{
+		Dependency: &dep.FakeDepFetchError{Code: http.StatusForbidden},
+		RetryFunc: func(retry int) (bool, time.Duration) {
+			return retry < 2, time.Millisecond
+		},
+	})
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+
+	go vw.poll(viewCh, errCh)
+	defer vw.stop()
+
+	select {
+	case <-viewCh:
+		t.Errorf("expected no data")
+	case err := <-errCh:
+		var fetchErr *hdep.FetchError
+		if !errors.As(err, &fetchErr) {
+			t.Fatalf("expected a FetchError, got %T", err)
+		}
+		if !fetchErr.Retryable || !fetchErr.PermissionDenied() {
+			t.Errorf("expected retryable permission denied, got %+v", fetchErr)
+		}
+		if fetchErr.Attempts != 2 {
+			t.Errorf("expected 2 retries, got %d", fetchErr.Attempts)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+}
+
+// throttledDep is rate limited (429) on its first fetches
+type throttledDep struct {
+	dep.FakeDep
+	sync.Mutex
+	throttles int
+}
+
+func (d *throttledDep) Fetch(c hdep.Clients) (interface{}, *hdep.ResponseMetadata, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.throttles > 0 {
+		d.throttles--
+		return nil, nil, errors.New("Unexpected response code: 429")
+	}
+	return d.FakeDep.Fetch(c)
+}
+
+func TestPoll_throttled(t *testing.T) {
+	var mux sync.Mutex
+	var throttled []events.Throttled
+	var serverErrors int
+	vw := newView(&newViewInput{
+		Dependency: &throttledDep{FakeDep: dep.FakeDep{Name: "foo"}, throttles: 3},
+		RetryFunc: func(int) (bool, time.Duration) {
+			return false, 0
+		},
+		EventHandler: func(e events.Event) {
+			mux.Lock()
+			defer mux.Unlock()
+			switch e := e.(type) {
+			case events.Throttled:
+				throttled = append(throttled, e)
+			case events.ServerError:
+				serverErrors++
+			}
+		},
+	})
+	vw.throttleFunc = func(attempt int) (bool, time.Duration) {
+		return true, time.Duration(attempt+1) * time.Millisecond
+	}
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+
+	go vw.poll(viewCh, errCh)
+	defer vw.stop()
+
+	select {
+	case <-viewCh:
+	case err := <-errCh:
+		t.Fatalf("rate limited queries shouldn't error: %s", err)
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if serverErrors != 0 {
+		t.Errorf("expected no server errors, got %d", serverErrors)
+	}
+	if len(throttled) != 3 {
+		t.Fatalf("expected 3 throttled events, got %+v", throttled)
+	}
+	for i, e := range throttled {
+		sleep := time.Duration(i+1) * time.Millisecond
+		if e.Attempt != i+1 || e.Sleep != sleep || e.Error == nil {
+			t.Errorf("bad throttled event %d: %+v", i, e)
+		}
+	}
+}
+
+// flakyDep fails (500) after its first fetch, until failures run out
+type flakyDep struct {
+	dep.FakeDep
+	sync.Mutex
+	index    uint64
+	failures int
+	// bare fails with a FetchError without an ID or kind
+	bare bool
+}
+
+func (d *flakyDep) Fetch(hdep.Clients) (interface{}, *hdep.ResponseMetadata, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.index > 0 && d.failures > 0 {
+		d.failures--
+		if d.bare {
+			return nil, nil, &hdep.FetchError{Err: errors.New("failed")}
+		}
+		return nil, nil, errors.New("Unexpected response code: 500")
+	}
+	d.index++
+	return d.index, &hdep.ResponseMetadata{LastIndex: d.index}, nil
+}
+
+func TestPoll_degraded(t *testing.T) {
+	noRetry := func(int) (bool, time.Duration) { return false, 0 }
+	newFlakyView := func(failures int, maxDegraded time.Duration,
+		evCh chan events.Event) *view {
+		vw := newView(&newViewInput{
+			Dependency:  &flakyDep{FakeDep: dep.FakeDep{Name: "foo"}, failures: failures},
+			RetryFunc:   noRetry,
+			MaxDegraded: maxDegraded,
+			EventHandler: func(e events.Event) {
+				switch e.(type) {
+				case events.Degraded, events.Recovered:
+					evCh <- e
+				}
+			},
+		})
+		vw.degradedFunc = func(int) (bool, time.Duration) {
+			return true, 5 * time.Millisecond
+		}
+		return vw
+	}
+	firstData := func(t *testing.T, viewCh chan *view, errCh chan error) {
+		select {
+		case <-viewCh:
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	t.Run("recovered", func(t *testing.T) {
+		evCh := make(chan events.Event, 10)
+		vw := newFlakyView(3, time.Minute, evCh)
+		viewCh := make(chan *view)
+		errCh := make(chan error)
+		go vw.poll(viewCh, errCh)
+		defer vw.stop()
+		firstData(t, viewCh, errCh)
+
+		select {
+		case <-viewCh:
+		case err := <-errCh:
+			t.Fatalf("degraded view shouldn't error: %s", err)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		if vw.Data() != uint64(2) {
+			t.Errorf("expected new data once recovered, got %v", vw.Data())
+		}
+
+		e, ok := (<-evCh).(events.Degraded)
+		if !ok || e.ID != vw.ID() || e.Error == nil || e.LastData.IsZero() {
+			t.Errorf("bad degraded event: %+v", e)
+		}
+		r, ok := (<-evCh).(events.Recovered)
+		if !ok || r.ID != vw.ID() || r.Duration <= 0 {
+			t.Errorf("bad recovered event: %+v", r)
+		}
+		if snap := vw.snapshot(nil); !snap.DegradedSince.IsZero() {
+			t.Errorf("expected view to have left degraded mode: %+v", snap)
+		}
+	})
+
+	t.Run("too-stale", func(t *testing.T) {
+		evCh := make(chan events.Event, 10)
+		vw := newFlakyView(1000, 50*time.Millisecond, evCh)
+		viewCh := make(chan *view)
+		errCh := make(chan error)
+		go vw.poll(viewCh, errCh)
+		defer vw.stop()
+		firstData(t, viewCh, errCh)
+
+		select {
+		case <-viewCh:
+			t.Fatal("expected no data")
+		case err := <-errCh:
+			if !strings.Contains(err.Error(), "500") {
+				t.Errorf("unexpected error: %s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the error once the data was too stale")
+		}
+		if _, ok := (<-evCh).(events.Degraded); !ok {
+			t.Error("expected a degraded event")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		evCh := make(chan events.Event, 10)
+		vw := newFlakyView(1, 0, evCh)
+		viewCh := make(chan *view)
+		errCh := make(chan error)
+		go vw.poll(viewCh, errCh)
+		defer vw.stop()
+		firstData(t, viewCh, errCh)
+
+		select {
+		case <-viewCh:
+			t.Fatal("expected no data")
+		case <-errCh:
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		if len(evCh) != 0 {
+			t.Errorf("expected no degraded mode, got %v", <-evCh)
+		}
+	})
+}
+
+// backendDep has new data on each fetch, served by the streaming backend
+type backendDep struct {
+	dep.FakeDep
+	sync.Mutex
+	index     uint64
+	streaming bool
+}
+
+func (d *backendDep) Fetch(hdep.Clients) (interface{}, *hdep.ResponseMetadata, error) {
+	d.Lock()
+	defer d.Unlock()
+	d.index++
+	d.streaming = d.Opts.UseStreaming
+	rm := &hdep.ResponseMetadata{LastIndex: d.index, QueryBackend: "streaming"}
+	return d.index, rm, nil
+}
+
+func TestFetch_queryBackend(t *testing.T) {
+	var mux sync.Mutex
+	var backends []events.QueryBackend
+	d := &backendDep{}
+	vw := newView(&newViewInput{
+		Dependency:   d,
+		UseStreaming: true,
+		EventHandler: func(e events.Event) {
+			if e, ok := e.(events.QueryBackend); ok {
+				mux.Lock()
+				defer mux.Unlock()
+				backends = append(backends, e)
+			}
+		},
+	})
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+	go vw.poll(viewCh, errCh)
+	defer vw.stop()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-viewCh:
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	exp := []events.QueryBackend{{ID: d.ID(), Backend: "streaming"}}
+	if !reflect.DeepEqual(exp, backends) {
+		t.Errorf("expected one event once blocking\nexp: %+v\nact: %+v",
+			exp, backends)
+	}
+	snap := vw.snapshot(nil)
+	if snap.Fetches < 3 || snap.QueryBackend != "streaming" {
+		t.Errorf("bad view snapshot: %+v", snap)
+	}
+	d.Lock()
+	defer d.Unlock()
+	if !d.streaming {
+		t.Error("expected streaming to be asked for")
+	}
+}
+
+// cachedDep has the same data on each fetch, served by the agent cache when
+// asked for
+type cachedDep struct {
+	dep.FakeDep
+	sync.Mutex
+	index uint64
+}
+
+func (d *cachedDep) Fetch(hdep.Clients) (interface{}, *hdep.ResponseMetadata, error) {
+	d.Lock()
+	defer d.Unlock()
+	d.index++
+	rm := &hdep.ResponseMetadata{LastIndex: d.index,
+		CacheHit: d.Opts.UseCache, CacheAge: d.Opts.MaxAge}
+	return "data", rm, nil
+}
+
+func TestFetch_cacheHit(t *testing.T) {
+	evCh := make(chan events.Event, 10)
+	d := &cachedDep{}
+	vw := newView(&newViewInput{
+		Dependency: d,
+		UseCache:   true,
+		MaxAge:     time.Minute,
+		EventHandler: func(e events.Event) {
+			switch e.(type) {
+			case events.NewData, events.NoNewData:
+				select {
+				case evCh <- e:
+				default:
+				}
+			}
+		},
+	})
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+	go vw.poll(viewCh, errCh)
+	defer vw.stop()
+
+	next := func() events.Event {
+		select {
+		case e := <-evCh:
+			return e
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+		return nil
+	}
+
+	exp := events.NewData{ID: d.ID(), Data: "data",
+		CacheHit: true, CacheAge: time.Minute}
+	if e := next(); !reflect.DeepEqual(exp, e) {
+		t.Errorf("bad event\nexp: %+v\nact: %+v", exp, e)
+	}
+	<-viewCh
+	expNo := events.NoNewData{ID: d.ID(), CacheHit: true, CacheAge: time.Minute}
+	if e := next(); !reflect.DeepEqual(expNo, e) {
+		t.Errorf("bad event\nexp: %+v\nact: %+v", expNo, e)
+	}
+}
+
 func TestFetch_resetRetries(t *testing.T) {
 	view := newView(&newViewInput{
 		Dependency: &dep.FakeDepSameIndex{},
@@ -227,7 +642,7 @@ func TestFetch_returnsErrCh(t *testing.T) {
 		t.Errorf("expected error, but received doneCh")
 	case err := <-errCh:
 		expected := http.StatusInternalServerError
-		actual := getResponseCodeFromError(err)
+		actual := dep.ResponseCode(err)
 		if actual != expected {
 			t.Fatalf("expected status code %q to be %q", actual, expected)
 		}
@@ -423,3 +838,92 @@ func TestPollingEvents(t *testing.T) {
 		t.Errorf("got unexpected stop")
 	}
 }
+
+func TestFetch_pollingWait(t *testing.T) {
+	fdep := &dep.FakeDepPolling{Name: "foo", Wait: time.Millisecond}
+	waits := make(chan time.Duration, 10)
+	vw := newView(&newViewInput{
+		Dependency: fdep,
+		EventHandler: func(e events.Event) {
+			if v, ok := e.(events.PollingWait); ok {
+				waits <- v.Duration
+			}
+		},
+	})
+	defer vw.stop()
+
+	for i := 0; i < 2; i++ {
+		doneCh := make(chan struct{})
+		successCh := make(chan struct{}, 1)
+		errCh := make(chan error)
+
+		go vw.fetch(doneCh, successCh, errCh)
+
+		select {
+		case <-doneCh:
+		case err := <-errCh:
+			t.Fatalf("error while fetching: %s", err)
+		}
+	}
+
+	// only the second fetch should have waited
+	if len(waits) != 1 {
+		t.Fatalf("expected 1 polling wait, got %d", len(waits))
+	}
+	if wait := <-waits; wait != fdep.Wait {
+		t.Errorf("bad polling wait, wanted: %v, got: %v", fdep.Wait, wait)
+	}
+}
+
+func TestFetch_pollingWaitRetry(t *testing.T) {
+	fdep := &dep.FakeDepPolling{Name: "foo", Wait: time.Hour}
+	vw := newView(&newViewInput{Dependency: fdep})
+	defer vw.stop()
+
+	// the first fetch is immediate, the second only because it is a retry
+	for i := 0; i < 2; i++ {
+		doneCh := make(chan struct{})
+		successCh := make(chan struct{}, 1)
+		errCh := make(chan error)
+
+		vw.retrying = i > 0
+		go vw.fetch(doneCh, successCh, errCh)
+
+		select {
+		case <-doneCh:
+		case err := <-errCh:
+			t.Fatalf("error while fetching: %s", err)
+		case <-time.After(time.Second):
+			t.Fatal("retry waited for the polling wait")
+		}
+	}
+	if vw.retrying {
+		t.Error("retrying flag should be cleared by fetch")
+	}
+}
+
+func TestFetch_pollingWaitOption(t *testing.T) {
+	fdep := &dep.FakeDepPolling{Name: "foo"}
+	vw := newView(&newViewInput{
+		Dependency:  fdep,
+		PollingWait: time.Minute,
+	})
+	defer vw.stop()
+
+	doneCh := make(chan struct{})
+	successCh := make(chan struct{}, 1)
+	errCh := make(chan error)
+
+	go vw.fetch(doneCh, successCh, errCh)
+
+	select {
+	case <-doneCh:
+	case err := <-errCh:
+		t.Fatalf("error while fetching: %s", err)
+	}
+
+	if wait := fdep.GetOptions().PollingWait; wait != time.Minute {
+		t.Errorf("bad polling wait option, wanted: %v, got: %v",
+			time.Minute, wait)
+	}
+}
@@ -6,6 +6,7 @@ package hcat
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,10 +19,32 @@ import (
 // dataBufferSize is the default number of views to process in a batch.
 const DefaultDataBufferSize = 2048
 
+// MinPollingWait is the shortest polling wait allowed in WatcherInput.
+const MinPollingWait = time.Second
+
 // standard error returned when you try to register the same notifier twice
 var ErrRegistry = fmt.Errorf("duplicate watcher registry entry")
 var ErrStop = fmt.Errorf("Stop")
 
+// NotifierError is the error Wait and Watch return when a dependency fails.
+// It names the notifiers using the dependency, so the others can keep going.
+type NotifierError struct {
+	// ID is the failed dependency's ID.
+	ID string
+	// Notifiers are the IDs of the notifiers using the dependency, sorted.
+	Notifiers []string
+	// Err is the dependency's error, a *dep.FetchError.
+	Err error
+}
+
+func (e *NotifierError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NotifierError) Unwrap() error {
+	return e.Err
+}
+
 // RetryFunc defines the function type used to determine how many and how often
 // to retry calls to the external services.
 type RetryFunc func(int) (bool, time.Duration)
@@ -40,8 +63,15 @@ var _ Collector = (*Watcher)(nil)
 
 // Watcher is a manager for views that poll external sources for data.
 type Watcher struct {
+	// configLock guards the clients and the settings Reconfigure changes
+	configLock sync.RWMutex
+
 	// clients is the collection of API clients to talk to upstreams.
 	clients Looker
+	// replacedClients are the clients swapped out by Reconfigure, stopped
+	// along with the clients. clientsStopped is set once they are.
+	replacedClients []Looker
+	clientsStopped  bool
 	// cache stores the data fetched from remote sources
 	cache Cacher
 	// event holds the callback for event processing
@@ -67,26 +97,63 @@ type Watcher struct {
 	// completed their active buffer period.
 	bufferTrigger chan string
 
+	// retryPolicies holds the retry functions by dependency kind, along with
+	// any per notifier overrides.
+	retryPolicies *retryPolicies
+
 	// Consul related
-	retryFuncConsul RetryFunc
 	// blockWaitTime is how long to block on consul's blocking queries
 	blockWaitTime time.Duration
 	// maxStale passed to consul to control staleness
 	maxStale time.Duration
+	// consulStreaming asks for Consul's streaming backend
+	consulStreaming bool
+	// consulUseCache, consulMaxAge and consulStaleIfError ask for the
+	// Consul agent cache
+	consulUseCache     bool
+	consulMaxAge       time.Duration
+	consulStaleIfError time.Duration
 
 	// Vault related
-	retryFuncVault RetryFunc
 	// defaultLease is used for non-renewable leases when secret has no lease
 	defaultLease time.Duration
+
+	// pollingWaits override, by dependency kind, the wait between fetches
+	// for dependencies that don't support blocking queries
+	pollingWaits map[DependencyKind]time.Duration
+
+	// pool shares the views of shareable dependencies with other watchers
+	pool *ViewPool
+
+	// limiter caps the number of queries in flight
+	limiter *queryLimiter
+
+	// maxDegraded is how long views keep serving their last data after
+	// exhausting their retries
+	maxDegraded time.Duration
+
+	// isolateErrors notifies the notifiers of failed dependencies instead of
+	// returning the errors from Wait and Watch
+	isolateErrors bool
+	// repollFunc gives the sleep before polling an isolated failed
+	// dependency again
+	repollFunc RetryFunc
+
+	// goroutines counts the running goroutines, for Shutdown
+	goroutines *goroutines
 }
 
 type WatcherInput struct {
-	// Clients is the client set to communicate with upstreams.
+	// Clients is the client set to communicate with upstreams. The Watcher
+	// stops it when stopped, which releases a ClientSet once the last of the
+	// Watchers using it stops it (see ClientSet.Stop).
 	Clients Looker
 	// Cache is the Cacher for caching watched values
 	Cache Cacher
 
-	// EventHandler takes the callback for event processing
+	// EventHandler takes the callback for event processing. It is also sent
+	// the credential rotation events of the Clients, unless they already
+	// have a handler (see ClientSet.SetEventHandler).
 	EventHandler events.EventHandler
 
 	// Optional Vault specific parameters
@@ -102,6 +169,67 @@ type WatcherInput struct {
 	ConsulBlockWait time.Duration
 	// RetryFun for Consul
 	ConsulRetryFunc RetryFunc
+	// Streaming states that the Consul agent serves the health service
+	// queries with its streaming backend, which puts much less load on the
+	// servers than blocking queries. Streaming is enabled on the agent (its
+	// use_streaming_backend setting), not here: the queries stay the same
+	// but for the cache options, which are left out as the agent keeps its
+	// own streamed view. Once the agent serves a blocking query with the
+	// blocking-query backend instead, the cache options apply again. The
+	// backend in use is reported, see events.QueryBackend.
+	ConsulStreaming bool
+	// UseCache asks the Consul agent to serve the queries of the endpoints
+	// it caches (health and catalog services, prepared queries) from its
+	// cache. MaxAge is the maximum age of a cached response before the agent
+	// refreshes it and StaleIfError how old it may be when the servers can't
+	// be reached, either implies UseCache. Templates can set these per query
+	// with the "cached", "max-age" and "stale-if-error" options. Cache hits
+	// are reported in the events.NewData and events.NoNewData events.
+	// Streaming health service queries aren't cached.
+	ConsulUseCache     bool
+	ConsulMaxAge       time.Duration
+	ConsulStaleIfError time.Duration
+
+	// Optional retry parameters
+	// RetryFuncs sets the retry function per dependency kind. The Consul and
+	// Vault retry functions above take precedence over these when set. Kinds
+	// left unset retry with a jittered exponential backoff, from 250ms up to
+	// 1m between attempts, for up to 5 minutes.
+	RetryFuncs map[DependencyKind]RetryFunc
+
+	// Optional polling parameters
+	// PollingWaits overrides, by dependency kind, the time to wait between
+	// fetches for dependencies that don't support blocking queries (eg.
+	// KindFile for files, KindConsul for catalog datacenters and prepared
+	// queries, KindVault for Vault lists). Kinds left unset use each
+	// dependency's default. Waits under MinPollingWait are raised to it, as
+	// these dependencies use the time in seconds as their index.
+	PollingWaits map[DependencyKind]time.Duration
+
+	// ViewPool shares the upstream queries of shareable dependencies with
+	// the other Watchers given the same pool and Clients.
+	ViewPool *ViewPool
+
+	// MaxConcurrentQueries caps the number of queries in flight, eg. to stay
+	// under Consul's http_max_conns_per_client. Views wait their turn for a
+	// slot and emit a QueryQueued event. Blocking queries hold their slot
+	// until they return, so with more views than slots ConsulBlockWait bounds
+	// how long the others wait. Zero means no limit.
+	MaxConcurrentQueries int
+
+	// DegradedMaxStale enables a degraded mode for dependencies that have
+	// received data: once their retries are exhausted, instead of Wait
+	// returning the error, their last data keeps being served while they
+	// retry in the background, until it is older than DegradedMaxStale. The
+	// Degraded and Recovered events mark the transitions. Zero disables it.
+	DegradedMaxStale time.Duration
+
+	// IsolateErrors keeps a failed dependency from stopping Wait and Watch.
+	// Instead of returning a *NotifierError, they notify the notifiers using
+	// the dependency so they can be marked as failed (see Errors), while the
+	// healthy ones keep rendering. The failed dependency is polled again
+	// after a backoff, until it recovers.
+	IsolateErrors bool
 
 	// Override the default data buffer size (for testing)
 	DataBufferSize *int
@@ -132,6 +260,9 @@ func NewWatcher(i WatcherInput) *Watcher {
 	eventHandler := i.EventHandler
 	if eventHandler == nil {
 		eventHandler = func(events.Event) {}
+	} else if cs, ok := clients.(*ClientSet); ok {
+		// send it the credential rotation events too
+		cs.useEventHandler(eventHandler)
 	}
 
 	var dataBufferSize int
@@ -143,29 +274,110 @@ func NewWatcher(i WatcherInput) *Watcher {
 	}
 
 	bufferTriggerCh := make(chan string, dataBufferSize/2)
+	bufferTimers := newTimers()
+	bufferTimers.event = eventHandler
 	w := &Watcher{
-		clients:         clients,
-		cache:           cache,
-		event:           eventHandler,
-		dataCh:          make(chan *view, dataBufferSize),
-		errCh:           make(chan error),
-		waitingCh:       make(chan struct{}, 1),
-		stopCh:          make(chan struct{}, 1),
-		tracker:         newTracker(),
-		bufferTrigger:   bufferTriggerCh,
-		bufferTimers:    newTimers(),
-		retryFuncConsul: i.ConsulRetryFunc,
-		maxStale:        i.ConsulMaxStale,
-		blockWaitTime:   i.ConsulBlockWait,
-		retryFuncVault:  i.VaultRetryFunc,
-		defaultLease:    i.VaultDefaultLease,
-	}
-
-	go w.bufferTimers.Run(bufferTriggerCh)
+		clients:       clients,
+		cache:         cache,
+		event:         eventHandler,
+		dataCh:        make(chan *view, dataBufferSize),
+		errCh:         make(chan error),
+		waitingCh:     make(chan struct{}, 1),
+		stopCh:        make(chan struct{}, 1),
+		tracker:       newTracker(),
+		bufferTrigger: bufferTriggerCh,
+		bufferTimers:  bufferTimers,
+		retryPolicies: newRetryPolicies(nil),
+		pool:          i.ViewPool,
+		limiter:       newQueryLimiter(i.MaxConcurrentQueries),
+		goroutines:    newGoroutines(),
+		repollFunc:    repollBackoff,
+	}
+	w.configure(i)
+	useClients(clients)
+
+	ran, _ := w.goroutines.start("buffer timers")
+	go func() {
+		defer ran()
+		w.bufferTimers.Run(bufferTriggerCh)
+	}()
 
 	return w
 }
 
+// configure sets the settings that Reconfigure can change, the caller must
+// hold the configLock if the watcher is in use.
+func (w *Watcher) configure(i WatcherInput) {
+	retryFuncs := make(map[DependencyKind]RetryFunc, len(i.RetryFuncs)+2)
+	for kind, f := range i.RetryFuncs {
+		retryFuncs[kind] = f
+	}
+	if i.ConsulRetryFunc != nil {
+		retryFuncs[KindConsul] = i.ConsulRetryFunc
+	}
+	if i.VaultRetryFunc != nil {
+		retryFuncs[KindVault] = i.VaultRetryFunc
+	}
+	for _, kind := range dependencyKinds {
+		if retryFuncs[kind] == nil {
+			retryFuncs[kind] = defaultRetryFunc
+		}
+	}
+	w.retryPolicies.setDefaults(retryFuncs)
+
+	pollingWaits := make(map[DependencyKind]time.Duration, len(i.PollingWaits))
+	for kind, wait := range i.PollingWaits {
+		if wait < MinPollingWait {
+			wait = MinPollingWait
+		}
+		pollingWaits[kind] = wait
+	}
+	w.pollingWaits = pollingWaits
+
+	w.maxStale = i.ConsulMaxStale
+	w.blockWaitTime = i.ConsulBlockWait
+	w.consulStreaming = i.ConsulStreaming
+	w.consulUseCache = i.ConsulUseCache || i.ConsulMaxAge != 0 ||
+		i.ConsulStaleIfError != 0
+	w.consulMaxAge = i.ConsulMaxAge
+	w.consulStaleIfError = i.ConsulStaleIfError
+	w.defaultLease = i.VaultDefaultLease
+	w.maxDegraded = i.DegradedMaxStale
+	w.isolateErrors = i.IsolateErrors
+}
+
+// Reconfigure applies the input's settings to the watcher and its views,
+// keeping the cached data and the tracked dependencies. The views use them
+// from their next fetch on, in-flight fetches aren't interrupted. The clients
+// are swapped if Clients is set, the previous ones are only stopped when the
+// watcher is, as fetches in flight may still be using them. Views shared through a ViewPool keep
+// their shared query, which is configured by the pool (see ViewPool), until
+// they are tracked anew, eg. after being swept.
+//
+// The retry functions replace the watcher's defaults, per notifier overrides
+// set with SetRetryFunc are kept. Cache, EventHandler, ViewPool,
+// MaxConcurrentQueries and DataBufferSize can't be changed and are ignored.
+func (w *Watcher) Reconfigure(i WatcherInput) {
+	w.configLock.Lock()
+	if i.Clients != nil && i.Clients != w.clients {
+		useClients(i.Clients)
+		w.replacedClients = append(w.replacedClients, w.clients)
+		w.clients = i.Clients
+	}
+	w.configure(i)
+	w.configLock.Unlock()
+
+	for _, v := range w.tracker.allViews() {
+		if v.shared != nil {
+			continue
+		}
+		v.dataLock.RLock()
+		retryNotifier := v.retryNotifier
+		v.dataLock.RUnlock()
+		v.reconfigure(w.viewInput(v.Dependency(), retryNotifier))
+	}
+}
+
 const vaultTokenDummyTemplateID = "dummy.watcher.vault-token.id"
 
 // WatchVaultToken takes a vault token and watches it to keep it updated.
@@ -193,6 +405,8 @@ func (w *Watcher) WatchVaultToken(token string) error {
 // Clients returns the Looker/ClientSet to give easy access to the clients
 // after initial setup.
 func (w *Watcher) Clients() Looker {
+	w.configLock.RLock()
+	defer w.configLock.RUnlock()
 	return w.clients
 }
 
@@ -207,7 +421,8 @@ func (w *Watcher) WaitCh(ctx context.Context) <-chan error {
 }
 
 // Wait blocks until new a watched value changes or until context is closed
-// or exceeds its deadline.
+// or exceeds its deadline. A failed dependency's error is returned as a
+// *NotifierError, unless IsolateErrors is set.
 func (w *Watcher) Wait(ctx context.Context) error {
 	w.stopCh.drain() // in case Stop was already called
 
@@ -231,6 +446,7 @@ func (w *Watcher) Wait(ctx context.Context) error {
 // the provided channel which templates have changes to be rendered. Useful
 // for when caller wants to process templates asynchronously. Only one Watch
 // should be called at given time and should not be called with Wait.
+// Failed dependencies are handled as with Wait.
 func (w *Watcher) Watch(ctx context.Context, notifierCh chan string) error {
 	w.stopCh.drain()
 
@@ -271,6 +487,7 @@ func (w *Watcher) wait(ctx context.Context) (map[string]struct{}, error) {
 	dataUpdate := func(v *view, notifiers notifierMap) notifierMap {
 		id := v.ID()
 		w.cache.Save(id, v.Data())
+		w.tracker.clearError(id)
 		for _, n := range w.tracker.notifiersFor(v) {
 			if n.Notify(v.Data()) && !w.Buffering(n) {
 				notifiers[n.ID()] = empty
@@ -294,7 +511,7 @@ func (w *Watcher) wait(ctx context.Context) (map[string]struct{}, error) {
 				drain = false
 			}
 		}
-		return notifiers, nil
+		return w.rateLimit(notifiers), nil
 	case nID := <-w.bufferTrigger:
 		notifiers[nID] = empty
 		// A template is now ready to be rendered, though there might be a
@@ -308,19 +525,51 @@ func (w *Watcher) wait(ctx context.Context) (map[string]struct{}, error) {
 				drain = false
 			}
 		}
-		return notifiers, nil
+		return w.rateLimit(notifiers), nil
 	case <-w.stopCh:
 		return nil, ErrStop
 
 	case err := <-w.errCh:
-		// Push the error back up the stack
-		return nil, err
+		var fetchErr *dep.FetchError
+		if !errors.As(err, &fetchErr) {
+			// Push the error back up the stack
+			return nil, err
+		}
+		// Route the error to the notifiers using the dependency
+		w.configLock.RLock()
+		isolate := w.isolateErrors
+		w.configLock.RUnlock()
+		nIDs, attempt := w.tracker.setError(fetchErr.ID, err, isolate)
+		if !isolate {
+			return nil, &NotifierError{
+				ID:        fetchErr.ID,
+				Notifiers: nIDs,
+				Err:       err,
+			}
+		}
+		for _, nID := range nIDs {
+			notifiers[nID] = empty
+		}
+		w.repoll(fetchErr.ID, attempt)
+		return notifiers, nil
 
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
+// rateLimit removes the notifiers that are over their rate limit, reporting
+// each suppressed render. They are notified once the rate limit allows.
+func (w *Watcher) rateLimit(notifiers map[string]struct{}) map[string]struct{} {
+	for id := range notifiers {
+		if ok, delay := w.bufferTimers.allow(id); !ok {
+			w.event(events.RenderSuppressed{ID: id, Delay: delay})
+			delete(notifiers, id)
+		}
+	}
+	return notifiers
+}
+
 // Buffering sets the template to activate buffer and accumulate changes for a
 // period. If the template has not been initalized or a buffer period is not
 // configured for the template, it will skip the buffering.
@@ -335,6 +584,12 @@ func (w *Watcher) Buffering(n Notifier) bool {
 	return false
 }
 
+// BufferStates returns the state of the templates' buffer periods, sorted by
+// template ID, eg. to see why a render is delayed.
+func (w *Watcher) BufferStates() []BufferState {
+	return w.bufferTimers.States()
+}
+
 // BufferReset resets an active buffer period to inactive.
 func (w *Watcher) BufferReset(n Notifier) {
 	w.bufferTimers.Reset(n.ID())
@@ -376,29 +631,59 @@ func (w *Watcher) track(n Notifier, d dep.Dependency) *view {
 	if v, ok := w.tracker.lookup(n, d); ok {
 		return v
 	}
-	// Choose the correct retry function based off of the dependency's type.
-	// NOTE: I would like to abstract this part out to not have type specific
-	//       things embedded in general code.
-	var retryFunc RetryFunc
-	switch d.(type) {
-	case idep.ConsulType:
-		retryFunc = w.retryFuncConsul
-	case idep.VaultType:
-		retryFunc = w.retryFuncVault
+	input := w.viewInput(d, n.ID())
+	var v *view
+	switch {
+	case w.pool != nil && shareable(d):
+		v = w.pool.acquire(input)
+	default:
+		v = newView(input)
+	}
+	w.event(events.TrackStart{ID: v.ID()})
+	if tv := w.tracker.add(v, n); tv != v {
+		// already watched for another notifier, drop the new view
+		if v.shared != nil {
+			v.stop()
+		}
+		return tv
 	}
+	return v
+}
 
-	v := newView(&newViewInput{
+// viewInput returns the input for a view of the dependency with the
+// watcher's settings, using the notifier's retry function override if any.
+func (w *Watcher) viewInput(d dep.Dependency, notifierID string) *newViewInput {
+	// Choose the retry function based off of the dependency's kind, letting
+	// the notifier override it. Shared views use the policy of the notifier
+	// that first tracked it.
+	kind := dependencyKind(d)
+	retryFunc, override := w.retryPolicies.lookup(kind, notifierID)
+	var retryNotifier string
+	if override {
+		retryNotifier = notifierID
+	}
+
+	w.configLock.RLock()
+	defer w.configLock.RUnlock()
+	return &newViewInput{
 		Dependency:        d,
 		Clients:           w.clients,
 		EventHandler:      w.event,
 		MaxStale:          w.maxStale,
 		BlockWaitTime:     w.blockWaitTime,
 		RetryFunc:         retryFunc,
+		RetryKind:         string(kind),
+		RetryNotifier:     retryNotifier,
+		MaxDegraded:       w.maxDegraded,
 		VaultDefaultLease: w.defaultLease,
-	})
-	w.event(events.TrackStart{ID: v.ID()})
-	w.tracker.add(v, n)
-	return v
+		PollingWait:       w.pollingWaits[kind],
+		Limiter:           w.limiter,
+		Goroutines:        w.goroutines,
+		UseStreaming:      w.consulStreaming,
+		UseCache:          w.consulUseCache,
+		MaxAge:            w.consulMaxAge,
+		StaleIfError:      w.consulStaleIfError,
+	}
 }
 
 // Poll starts any/all polling as needed.
@@ -412,12 +697,43 @@ func (w *Watcher) Poll(deps ...dep.Dependency) {
 	}
 	for _, d := range deps {
 		if v := w.tracker.view(d.ID()); v != nil {
+			polled, ok := w.goroutines.start("poll " + v.ID())
+			if !ok {
+				return // shutting down
+			}
 			// view.poll checks if it is already polling
-			go v.poll(w.dataCh, w.errCh)
+			go func() {
+				defer polled()
+				v.poll(w.dataCh, w.errCh)
+			}()
 		}
 	}
 }
 
+// repoll polls the failed view again after a backoff. Its poll returned on
+// the error and, with its data cached, nothing else would restart it.
+func (w *Watcher) repoll(viewID string, attempt int) {
+	v := w.tracker.view(viewID)
+	if v == nil {
+		return
+	}
+	done, ok := w.goroutines.start("repoll " + viewID)
+	if !ok {
+		return // shutting down
+	}
+	_, sleep := w.repollFunc(attempt)
+	go func() {
+		defer done()
+		timer := time.NewTimer(sleep)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			w.Poll(v.Dependency())
+		case <-v.stopCh:
+		}
+	}()
+}
+
 // Recaller returns a Recaller (function) that wraps the Store (cache)
 // to enable tracking dependencies on the Watcher.
 func (w *Watcher) Recaller(n Notifier) Recaller {
@@ -427,6 +743,8 @@ func (w *Watcher) Recaller(n Notifier) Recaller {
 		switch {
 		case ok:
 			w.tracker.cacheAccessed(n, dep)
+		case w.tracker.repolling(dep.ID()):
+			// polled again after its backoff
 		default:
 			w.Poll(dep)
 		}
@@ -434,6 +752,13 @@ func (w *Watcher) Recaller(n Notifier) Recaller {
 	}
 }
 
+// Errors returns the errors of the failed dependencies, by the IDs of the
+// notifiers using them. A dependency's error is cleared once it receives
+// data again or is no longer used.
+func (w *Watcher) Errors() map[string][]error {
+	return w.tracker.errors()
+}
+
 // Complete checks if all values in use have been fetched.
 func (w *Watcher) Complete(n Notifier) bool {
 	return w.tracker.complete(n)
@@ -461,6 +786,28 @@ func (w *Watcher) SetBufferPeriod(min, max time.Duration, notifierIDs ...string)
 	}
 }
 
+// SetRateLimit limits how often the templates are notified of changes to
+// once every interval, allowing bursts of up to burst notifications. Changes
+// over the limit are held and notified once the limit allows, this is
+// reported with a RenderSuppressed event. It works with buffer periods, which
+// are applied first. A zero interval removes the limit, eg. to allow 6
+// renders a minute with bursts of 2:
+//
+//	w.SetRateLimit(10*time.Second, 2, tmpl.ID())
+func (w *Watcher) SetRateLimit(every time.Duration, burst int, notifierIDs ...string) {
+	for _, id := range notifierIDs {
+		w.bufferTimers.SetRateLimit(every, burst, id)
+	}
+}
+
+// SetRetryFunc sets the retry function for dependencies of the given kind.
+// With no notifier IDs it becomes the watcher's default, otherwise it only
+// applies to dependencies tracked by those templates. It affects dependencies
+// tracked after the call, already running views keep their retry function.
+func (w *Watcher) SetRetryFunc(kind DependencyKind, f RetryFunc, notifierIDs ...string) {
+	w.retryPolicies.set(kind, f, notifierIDs...)
+}
+
 // ID here is to meet the IDer interface and be used with events/logging
 func (w *Watcher) ID() string {
 	return fmt.Sprintf("watcher (%p)", w)
@@ -482,12 +829,44 @@ func (w *Watcher) Stop() {
 		w.cache.Reset()
 	}
 
-	// Close any idle TCP connections
-	if w.clients != nil {
-		w.clients.Stop()
+	// Close any idle TCP connections, releasing the clients once no other
+	// watcher uses them. Only the first Stop stops them, as each watcher
+	// counts as one user.
+	w.configLock.Lock()
+	stopped := w.clientsStopped
+	w.clientsStopped = true
+	clients := append(w.replacedClients, w.clients)
+	w.replacedClients = nil
+	w.configLock.Unlock()
+	if stopped {
+		return
+	}
+	for _, c := range clients {
+		if c != nil {
+			c.Stop()
+		}
+	}
+}
+
+// useClients registers the watcher as a user of the clients, if they count
+// their users (see ClientSet.Use).
+func useClients(clients Looker) {
+	if u, ok := clients.(interface{ Use() }); ok {
+		u.Use()
 	}
 }
 
+// Shutdown stops the watcher, like Stop, and waits for its goroutines to
+// return: the views' polling and fetching and the buffer timers. No polling
+// starts once called and in-flight fetches are canceled. If the context is
+// done first, the returned error names the goroutines still running.
+func (w *Watcher) Shutdown(ctx context.Context) error {
+	w.goroutines.close()
+	w.bufferTimers.Halt()
+	w.Stop()
+	return w.goroutines.wait(ctx)
+}
+
 // Size returns the number of views this watcher is watching.
 func (w *Watcher) Size() int {
 	return w.tracker.viewCount()
@@ -510,9 +889,12 @@ func (w *Watcher) view(id string) *view {
 
 func newTracker() *tracker {
 	return &tracker{
-		tracked:   make([]trackedPair, 0, 8),
-		views:     make(map[string]*view),
-		notifiers: make(map[string]Notifier),
+		tracked:    make(map[trackedKey]*trackedPair),
+		byView:     make(map[string]map[string]*trackedPair),
+		byNotifier: make(map[string]map[string]*trackedPair),
+		views:      make(map[string]*view),
+		notifiers:  make(map[string]Notifier),
+		failed:     make(map[string]*viewFailure),
 	}
 }
 
@@ -526,23 +908,9 @@ type trackedPair struct {
 	cacheAccessed bool
 }
 
-// markUsed sets as mark (=true) and returns new pair to keep as value
-func (tp trackedPair) markInUse() trackedPair {
-	tp.mark = true
-	return tp
-}
-
-// clearUse clears mark (=false) and returns new pair to keep as value
-func (tp trackedPair) clearInUse() trackedPair {
-	tp.mark = false
-	return tp
-}
-
-// markDataUsed sets fetched data as being used
-// this is only important for new dependencies, so only needs to be set once
-func (tp trackedPair) markCacheAccessed() trackedPair {
-	tp.cacheAccessed = true
-	return tp
+// trackedKey is the primary key of a trackedPair
+type trackedKey struct {
+	view, notify string
 }
 
 // IDer an interface that supports and ID
@@ -556,18 +924,19 @@ type Notifier interface {
 	Notify(interface{}) bool
 }
 
-// If performance of looping through tracked gets to be to much build 2 indexes
-// of views/notifiers to their trackedPair entries and use that to accel lookups.
-// It will require updating though, and complicates things. So wait.
-
 type tracker struct {
 	sync.Mutex
-	// think in terms of a many-2-many DB relationship
-	tracked []trackedPair
+	// think in terms of a many-2-many DB relationship, with the pairs
+	// indexed by view and by notifier
+	tracked    map[trackedKey]*trackedPair
+	byView     map[string]map[string]*trackedPair // viewID -> notifierID -> pair
+	byNotifier map[string]map[string]*trackedPair // notifierID -> viewID -> pair
 	// viewID -> view
 	views map[string]*view
 	// stringID -> Notifier (stringID is usually template-id)
 	notifiers map[string]Notifier
+	// viewID -> failure, for failed views
+	failed map[string]*viewFailure
 }
 
 // cacheAccessed records that the fetched data was used at least once
@@ -575,10 +944,8 @@ func (t *tracker) cacheAccessed(notifier IDer, d dep.Dependency) {
 	notifierID, depID := notifier.ID(), d.ID()
 	t.Lock()
 	defer t.Unlock()
-	for i, tp := range t.tracked {
-		if !tp.cacheAccessed && tp.view == depID && tp.notify == notifierID {
-			t.tracked[i] = tp.markCacheAccessed()
-		}
+	if tp, ok := t.tracked[trackedKey{view: depID, notify: notifierID}]; ok {
+		tp.cacheAccessed = true
 	}
 }
 
@@ -621,12 +988,7 @@ func (t *tracker) deregisterNotifiers(ns ...Notifier) {
 func (t *tracker) notifierTracked(n Notifier) bool {
 	t.Lock()
 	defer t.Unlock()
-	for _, tp := range t.tracked {
-		if tp.notify == n.ID() {
-			return true
-		}
-	}
-	return false
+	return len(t.byNotifier[n.ID()]) > 0
 }
 
 // lookup returns the view and true, or nil and false
@@ -637,14 +999,23 @@ func (t *tracker) lookup(notifier IDer, d dep.Dependency) (*view, bool) {
 	notifierID, depID := notifier.ID(), d.ID()
 	t.Lock()
 	defer t.Unlock()
-	for _, tp := range t.tracked {
-		if tp.view == depID && tp.notify == notifierID {
-			return t.views[tp.view], true
-		}
+	if _, ok := t.tracked[trackedKey{view: depID, notify: notifierID}]; ok {
+		return t.views[depID], true
 	}
 	return nil, false
 }
 
+// allViews returns the views
+func (t *tracker) allViews() []*view {
+	t.Lock()
+	defer t.Unlock()
+	views := make([]*view, 0, len(t.views))
+	for _, v := range t.views {
+		views = append(views, v)
+	}
+	return views
+}
+
 // view returns the view (or nil)
 // note that a view's and dependency's IDs are interchangeable (identical)
 func (t *tracker) view(viewID string) *view {
@@ -653,18 +1024,46 @@ func (t *tracker) view(viewID string) *view {
 	return t.views[viewID]
 }
 
-// adds new tracked entry
-func (t *tracker) add(v *view, n Notifier) {
+// adds new tracked entry, returns the view tracked (v unless the view was
+// already tracked)
+func (t *tracker) add(v *view, n Notifier) *view {
 	t.Lock()
 	defer t.Unlock()
-	if _, ok := t.views[v.ID()]; !ok {
+	if tv, ok := t.views[v.ID()]; ok {
+		v = tv
+	} else {
 		t.views[v.ID()] = v
 	}
 	if _, ok := t.notifiers[n.ID()]; !ok {
 		panic("attempt to use an unregistered notifier")
 	}
-	t.tracked = append(t.tracked,
-		trackedPair{view: v.ID(), notify: n.ID(), mark: true})
+	key := trackedKey{view: v.ID(), notify: n.ID()}
+	if tp, ok := t.tracked[key]; ok {
+		tp.mark = true
+		return v
+	}
+	tp := &trackedPair{view: key.view, notify: key.notify, mark: true}
+	t.tracked[key] = tp
+	if t.byView[tp.view] == nil {
+		t.byView[tp.view] = make(map[string]*trackedPair)
+	}
+	t.byView[tp.view][tp.notify] = tp
+	if t.byNotifier[tp.notify] == nil {
+		t.byNotifier[tp.notify] = make(map[string]*trackedPair)
+	}
+	t.byNotifier[tp.notify][tp.view] = tp
+	return v
+}
+
+// remove deletes the pair from the indexes
+func (t *tracker) remove(tp *trackedPair) {
+	delete(t.tracked, trackedKey{view: tp.view, notify: tp.notify})
+	if delete(t.byView[tp.view], tp.notify); len(t.byView[tp.view]) == 0 {
+		delete(t.byView, tp.view)
+	}
+	if delete(t.byNotifier[tp.notify], tp.view); len(t.byNotifier[tp.notify]) == 0 {
+		delete(t.byNotifier, tp.notify)
+	}
 }
 
 // Marks all trackedPairs w/ a view as having been used
@@ -672,10 +1071,8 @@ func (t *tracker) markInUse(notifier IDer, d dep.Dependency) {
 	notifierID, depID := notifier.ID(), d.ID()
 	t.Lock()
 	defer t.Unlock()
-	for i, tp := range t.tracked {
-		if tp.view == depID && tp.notify == notifierID {
-			t.tracked[i] = tp.markInUse()
-		}
+	if tp, ok := t.tracked[trackedKey{view: depID, notify: notifierID}]; ok {
+		tp.mark = true
 	}
 }
 
@@ -685,6 +1082,7 @@ func (t *tracker) stopViews() {
 	defer t.Unlock()
 	for id, view := range t.views {
 		delete(t.views, id)
+		delete(t.failed, id)
 		if view == nil {
 			continue
 		}
@@ -692,16 +1090,81 @@ func (t *tracker) stopViews() {
 	}
 }
 
+// viewFailure is a failed view's last error and the number of consecutive
+// failures before it. repoll is set if the view is polled again after a
+// backoff.
+type viewFailure struct {
+	err     error
+	attempt int
+	repoll  bool
+}
+
+// setError records the view's error, it returns the IDs of the notifiers
+// using the view, sorted, and the number of consecutive failures before.
+func (t *tracker) setError(viewID string, err error, repoll bool) ([]string, int) {
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.views[viewID]; !ok {
+		return nil, 0
+	}
+	f, ok := t.failed[viewID]
+	if ok {
+		f.attempt++
+	} else {
+		f = &viewFailure{}
+		t.failed[viewID] = f
+	}
+	f.err, f.repoll = err, repoll
+	nIDs := make([]string, 0, len(t.byView[viewID]))
+	for nID := range t.byView[viewID] {
+		nIDs = append(nIDs, nID)
+	}
+	sort.Strings(nIDs)
+	return nIDs, f.attempt
+}
+
+// repolling returns true if the failed view is polled again after a backoff.
+func (t *tracker) repolling(viewID string) bool {
+	t.Lock()
+	defer t.Unlock()
+	f, ok := t.failed[viewID]
+	return ok && f.repoll
+}
+
+// clearError forgets the view's error
+func (t *tracker) clearError(viewID string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.failed, viewID)
+}
+
+// errors returns the errors of failed views by the notifiers using them,
+// ordered by view ID
+func (t *tracker) errors() map[string][]error {
+	t.Lock()
+	defer t.Unlock()
+	viewIDs := make([]string, 0, len(t.failed))
+	for viewID := range t.failed {
+		viewIDs = append(viewIDs, viewID)
+	}
+	sort.Strings(viewIDs)
+	errs := make(map[string][]error)
+	for _, viewID := range viewIDs {
+		for nID := range t.byView[viewID] {
+			errs[nID] = append(errs[nID], t.failed[viewID].err)
+		}
+	}
+	return errs
+}
+
 // Return all Notifiers for a view
 func (t *tracker) notifiersFor(view IDer) []Notifier {
 	viewID := view.ID()
-	results := make([]Notifier, 0, 8)
 	t.Lock()
 	defer t.Unlock()
-	for _, tp := range t.tracked {
-		if tp.view == viewID {
-			results = append(results, t.notifiers[tp.notify])
-		}
+	results := make([]Notifier, 0, len(t.byView[viewID]))
+	for notifierID := range t.byView[viewID] {
+		results = append(results, t.notifiers[notifierID])
 	}
 	return results
 }
@@ -711,10 +1174,8 @@ func (t *tracker) notifiersFor(view IDer) []Notifier {
 func (t *tracker) complete(notifier IDer) bool {
 	t.Lock()
 	defer t.Unlock()
-	for _, tp := range t.tracked {
-		thisNotifier := tp.notify == notifier.ID()
-		cacheNotAccessed := !tp.cacheAccessed
-		if thisNotifier && cacheNotAccessed {
+	for _, tp := range t.byNotifier[notifier.ID()] {
+		if !tp.cacheAccessed {
 			return false
 		}
 	}
@@ -728,10 +1189,8 @@ func (t *tracker) complete(notifier IDer) bool {
 func (t *tracker) markForSweep(notifier IDer) {
 	t.Lock()
 	defer t.Unlock()
-	for i, tp := range t.tracked {
-		if tp.notify == notifier.ID() && tp.mark {
-			t.tracked[i] = tp.clearInUse()
-		}
+	for _, tp := range t.byNotifier[notifier.ID()] {
+		tp.mark = false
 	}
 }
 
@@ -741,23 +1200,20 @@ func (t *tracker) markForSweep(notifier IDer) {
 func (t *tracker) sweep(notifier IDer, cache Cacher) {
 	t.Lock()
 	defer t.Unlock()
-	used := make(map[string]struct{})
-	tmp := t.tracked[:0]
-	for _, tp := range t.tracked {
-		otherNotifier := tp.notify != notifier.ID()
-		if tp.mark || otherNotifier {
-			tmp = append(tmp, tp)
-			used[tp.view] = struct{}{}
-			used[tp.notify] = struct{}{}
+	for _, tp := range t.byNotifier[notifier.ID()] {
+		if tp.mark {
+			continue
 		}
-	}
-	t.tracked = tmp
-	// remove views/notifiers no longer referenced
-	for viewId, view := range t.views {
-		if _, ok := used[viewId]; !ok {
-			delete(t.views, viewId)
+		t.remove(tp)
+		// remove views no longer referenced
+		if _, ok := t.byView[tp.view]; ok {
+			continue
+		}
+		if view, ok := t.views[tp.view]; ok {
+			delete(t.views, tp.view)
+			delete(t.failed, tp.view)
 			view.stop()
-			cache.Delete(viewId)
+			cache.Delete(tp.view)
 		}
 	}
 }
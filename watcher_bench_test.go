@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package hcat
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// benchWatcher returns a watcher tracking views dependencies spread over
+// notifiers templates, each template using perNotifier of them. The values
+// are cached so that the Recallers don't start polling.
+func benchWatcher(b *testing.B, notifiers, views, perNotifier int,
+) (*Watcher, []Notifier, [][]dep.Dependency) {
+	b.Helper()
+	w := newWatcher()
+	b.Cleanup(w.Stop)
+
+	deps := make([]dep.Dependency, views)
+	for i := range deps {
+		deps[i] = &idep.FakeDep{Name: fmt.Sprintf("dep%d", i)}
+		w.cache.Save(deps[i].ID(), i)
+	}
+	ns := make([]Notifier, notifiers)
+	used := make([][]dep.Dependency, notifiers)
+	for i := range ns {
+		ns[i] = fakeNotifier(fmt.Sprintf("tmpl%d", i))
+		for j := 0; j < perNotifier; j++ {
+			d := deps[(i*perNotifier+j)%views]
+			used[i] = append(used[i], d)
+			w.Track(ns[i], d)
+		}
+	}
+	return w, ns, used
+}
+
+var benchSizes = []struct{ notifiers, views, perNotifier int }{
+	{10, 100, 10},
+	{1000, 10000, 10},
+	{5000, 20000, 20},
+}
+
+func BenchmarkWatcherRecaller(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("%d/%d", size.notifiers, size.views), func(b *testing.B) {
+			w, ns, used := benchWatcher(b, size.notifiers, size.views, size.perNotifier)
+			recallers := make([]Recaller, len(ns))
+			for i, n := range ns {
+				recallers[i] = w.Recaller(n)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := i % len(ns)
+				recallers[n](used[n][i%size.perNotifier])
+			}
+		})
+	}
+}
+
+func BenchmarkWatcherComplete(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("%d/%d", size.notifiers, size.views), func(b *testing.B) {
+			w, ns, _ := benchWatcher(b, size.notifiers, size.views, size.perNotifier)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.Complete(ns[i%len(ns)])
+			}
+		})
+	}
+}
+
+// BenchmarkWatcherRender runs the mark-and-sweep cycle around a render that
+// recalls all of a template's dependencies.
+func BenchmarkWatcherRender(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("%d/%d", size.notifiers, size.views), func(b *testing.B) {
+			w, ns, used := benchWatcher(b, size.notifiers, size.views, size.perNotifier)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := ns[i%len(ns)]
+				recall := w.Recaller(n)
+				w.MarkForSweep(n)
+				for _, d := range used[i%len(ns)] {
+					recall(d)
+				}
+				w.Sweep(n)
+			}
+		})
+	}
+}
+
+func BenchmarkTrackerNotifiersFor(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("%d/%d", size.notifiers, size.views), func(b *testing.B) {
+			w, _, used := benchWatcher(b, size.notifiers, size.views, size.perNotifier)
+			v := w.tracker.view(used[0][0].ID())
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.tracker.notifiersFor(v)
+			}
+		})
+	}
+}
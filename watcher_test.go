@@ -6,11 +6,14 @@ package hcat
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/hcat/dep"
+	"github.com/hashicorp/hcat/events"
 	idep "github.com/hashicorp/hcat/internal/dependency"
 	"github.com/pkg/errors"
 )
@@ -81,9 +84,9 @@ func TestWatcherAdd(t *testing.T) {
 	})
 	t.Run("consul-retry-func", func(t *testing.T) {
 		w := newWatcher()
-		w.retryFuncConsul = func(n int) (bool, time.Duration) {
+		w.SetRetryFunc(KindConsul, func(n int) (bool, time.Duration) {
 			return false, 0 * time.Second
-		}
+		})
 		defer w.Stop()
 
 		d := &idep.FakeDep{}
@@ -97,6 +100,33 @@ func TestWatcherAdd(t *testing.T) {
 			t.Fatal("Retry func was nil")
 		}
 	})
+	t.Run("notifier-retry-func", func(t *testing.T) {
+		w := newWatcher()
+		defer w.Stop()
+		w.SetRetryFunc(KindConsul, func(n int) (bool, time.Duration) {
+			return false, 0 * time.Second
+		}, "bar")
+
+		n := fakeNotifier("foo")
+		w.Register(n)
+		added := w.track(n, &idep.FakeDep{Name: "foo"})
+		if added.retryFunc == nil || added.retryNotifier != "" {
+			t.Fatal("Retry func should be the default for foo")
+		}
+
+		n = fakeNotifier("bar")
+		w.Register(n)
+		added = w.track(n, &idep.FakeDep{Name: "bar"})
+		if added.retryFunc == nil {
+			t.Fatal("Retry func was nil for bar")
+		}
+		if added.retryKind != string(KindConsul) {
+			t.Fatalf("bad retry kind: %s", added.retryKind)
+		}
+		if added.retryNotifier != "bar" {
+			t.Fatalf("bad retry notifier: %s", added.retryNotifier)
+		}
+	})
 }
 
 func TestWatcherRegister(t *testing.T) {
@@ -176,6 +206,178 @@ func TestWatcherDeregister(t *testing.T) {
 	}
 }
 
+func TestWatcherBufferStates(t *testing.T) {
+	w := newWatcher()
+	defer w.Stop()
+
+	w.SetBufferPeriod(time.Second, time.Minute, "foo", "bar")
+	states := w.BufferStates()
+	exp := []BufferState{
+		{ID: "bar", Min: time.Second, Max: time.Minute},
+		{ID: "foo", Min: time.Second, Max: time.Minute},
+	}
+	if !reflect.DeepEqual(exp, states) {
+		t.Fatalf("bad buffer states\nexp: %+v\nact: %+v", exp, states)
+	}
+
+	w.Buffering(fakeNotifier("foo"))
+	if states := w.BufferStates(); !states[1].Active ||
+		states[1].Deadline.IsZero() || states[0].Active {
+		t.Errorf("only foo should be buffering: %+v", states)
+	}
+}
+
+func TestWatcherStopClients(t *testing.T) {
+	clients := NewClientSet()
+	var closed bool
+	clients.AddClient(ClientInput{Name: "foo", Client: struct{}{},
+		Close: func() { closed = true }})
+	w1 := NewWatcher(WatcherInput{Clients: clients})
+	w2 := NewWatcher(WatcherInput{Clients: clients})
+
+	// stopping a watcher twice counts once
+	w1.Stop()
+	w1.Stop()
+	if _, ok := clients.Client("foo"); closed || !ok {
+		t.Fatal("clients still used by a watcher should be kept")
+	}
+
+	if err := w2.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := clients.Client("foo"); !closed || ok {
+		t.Error("expected the clients released by the last watcher")
+	}
+}
+
+func TestWatcherCredentialEvents(t *testing.T) {
+	var got []events.Event
+	clients := NewClientSet()
+	w := NewWatcher(WatcherInput{
+		Clients:      clients,
+		EventHandler: func(e events.Event) { got = append(got, e) },
+	})
+	defer w.Stop()
+
+	// no Consul client, the rotation fails
+	clients.RotateConsulToken("token")
+	if len(got) != 1 {
+		t.Fatalf("expected the rotation event: %#v", got)
+	}
+	if e, ok := got[0].(events.CredentialsRotationFailed); !ok ||
+		e.Client != "consul" {
+		t.Errorf("bad event: %#v", got[0])
+	}
+
+	// a handler set on the client set is kept
+	var own []events.Event
+	clients = NewClientSet()
+	clients.SetEventHandler(func(e events.Event) { own = append(own, e) })
+	w2 := NewWatcher(WatcherInput{
+		Clients:      clients,
+		EventHandler: func(e events.Event) { got = append(got, e) },
+	})
+	defer w2.Stop()
+	clients.RotateVaultToken("token")
+	if len(own) != 1 || len(got) != 1 {
+		t.Errorf("expected the client set's handler used: %#v %#v", own, got)
+	}
+}
+
+// failingFileDep is a file dependency failing every fetch
+type failingFileDep struct {
+	dep.IsFile
+	mux     sync.Mutex
+	fetches int
+}
+
+func (d *failingFileDep) Fetch(dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.fetches++
+	return nil, nil, errors.New("unreadable")
+}
+func (d *failingFileDep) ID() string     { return "failing-file" }
+func (d *failingFileDep) String() string { return d.ID() }
+func (d *failingFileDep) Stop()          {}
+
+func TestWatcherDefaultRetry(t *testing.T) {
+	w := NewWatcher(WatcherInput{})
+	defer w.Stop()
+	n := fakeNotifier("foo")
+	w.Register(n)
+	d := &failingFileDep{}
+	w.Recaller(n)(d)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d.mux.Lock()
+		fetches := d.fetches
+		d.mux.Unlock()
+		if fetches > 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the failing file dependency to be retried")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatcherBufferStatesFromEventHandler(t *testing.T) {
+	// an event handler looking up the buffer states on a buffer event
+	// must not deadlock the watcher
+	var w *Watcher
+	var states [][]BufferState
+	w = NewWatcher(WatcherInput{
+		Clients: NewClientSet(),
+		EventHandler: func(e events.Event) {
+			switch e.(type) {
+			case events.BufferStart, events.BufferExtend, events.BufferDeadline:
+				states = append(states, w.BufferStates())
+			}
+		},
+	})
+	defer w.Stop()
+
+	w.SetBufferPeriod(time.Minute, time.Hour, "foo")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Buffering(fakeNotifier("foo")) // start
+		w.Buffering(fakeNotifier("foo")) // extend
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deadlocked looking up buffer states from the event handler")
+	}
+	if len(states) != 2 || !states[0][0].Active || !states[1][0].Active {
+		t.Errorf("bad buffer states: %+v", states)
+	}
+}
+
+// test propagation of the polling waits by kind through to view
+func TestWatcherViewPollingWait(t *testing.T) {
+	w := NewWatcher(WatcherInput{
+		Clients: NewClientSet(),
+		PollingWaits: map[DependencyKind]time.Duration{
+			KindConsul: time.Millisecond,
+			KindVault:  time.Minute,
+		},
+	})
+	defer w.Stop()
+
+	d := &idep.FakeDep{}
+	w.Track(fakeNotifier("foo"), d)
+	v := w.view(d.ID())
+	// FakeDep is a Consul dependency, its wait is raised to the minimum
+	if v.pollingWait != MinPollingWait {
+		t.Errorf("polling wait not propagated to view; want: %v, got: %v",
+			MinPollingWait, v.pollingWait)
+	}
+}
+
 // test propagation of vault's DefaultLease through to view
 func TestWatcherViewLease(t *testing.T) {
 	testLease := time.Second * 9
@@ -709,6 +911,244 @@ func TestWatcherWait(t *testing.T) {
 	})
 }
 
+func TestWatcherNotifierErrors(t *testing.T) {
+	// the failing notifier uses both dependencies, the healthy one the good
+	track := func(w *Watcher) (bad, good dep.Dependency) {
+		// fail on the first error instead of retrying
+		w.SetRetryFunc(KindConsul, func(int) (bool, time.Duration) {
+			return false, 0
+		})
+		failing, healthy := fakeNotifier("failing"), fakeNotifier("healthy")
+		w.Register(failing, healthy)
+		bad = &idep.FakeDepFetchError{Name: "bad"}
+		good = &idep.FakeDep{Name: "good"}
+		w.Recaller(failing)(bad)
+		w.Recaller(failing)(good)
+		w.Recaller(healthy)(good)
+		return bad, good
+	}
+
+	t.Run("routed", func(t *testing.T) {
+		w := newWatcher(5)
+		defer w.Stop()
+		bad, _ := track(w)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var err error
+		for err == nil && ctx.Err() == nil {
+			err = w.Wait(ctx)
+		}
+		var nErr *NotifierError
+		if !errors.As(err, &nErr) {
+			t.Fatalf("expected a NotifierError, got %v", err)
+		}
+		if nErr.ID != bad.ID() || !reflect.DeepEqual(nErr.Notifiers, []string{"failing"}) {
+			t.Errorf("bad notifier error: %+v", nErr)
+		}
+		var fetchErr *dep.FetchError
+		if !errors.As(err, &fetchErr) {
+			t.Errorf("expected the FetchError to be wrapped, got %T", nErr.Err)
+		}
+
+		errs := w.Errors()
+		if len(errs) != 1 || len(errs["failing"]) != 1 {
+			t.Errorf("expected the failing notifier's error only: %v", errs)
+		}
+	})
+
+	t.Run("isolated", func(t *testing.T) {
+		w := NewWatcher(WatcherInput{
+			Clients:       NewClientSet(),
+			IsolateErrors: true,
+		})
+		defer w.Stop()
+		_, good := track(w)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		for {
+			_, ok := w.cache.Recall(good.ID())
+			if ok && len(w.Errors()) > 0 {
+				break
+			}
+			if err := w.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if ctx.Err() != nil {
+				t.Fatal("timeout")
+			}
+		}
+		if errs := w.Errors(); len(errs) != 1 || errs["failing"] == nil {
+			t.Errorf("expected the failing notifier's error only: %v", errs)
+		}
+	})
+
+	t.Run("cleared", func(t *testing.T) {
+		w := newWatcher(5)
+		defer w.Stop()
+		n := fakeNotifier("foo")
+		w.Register(n)
+		d := &idep.FakeDep{Name: "foo"}
+		v := w.track(n, d)
+		w.tracker.setError(d.ID(), errors.New("failed"), false)
+		if len(w.Errors()) != 1 {
+			t.Fatal("expected an error")
+		}
+		w.dataCh <- v.store("foo")
+		w.Wait(context.Background())
+		if errs := w.Errors(); len(errs) != 0 {
+			t.Errorf("expected the error cleared by new data: %v", errs)
+		}
+	})
+
+	recovered := func(t *testing.T, bare bool) {
+		noRetry := func(int) (bool, time.Duration) { return false, 0 }
+		w := NewWatcher(WatcherInput{
+			Clients:       NewClientSet(),
+			IsolateErrors: true,
+			RetryFuncs: map[DependencyKind]RetryFunc{
+				KindConsul: noRetry, KindVault: noRetry, KindNomad: noRetry,
+				KindFile: noRetry, KindOther: noRetry,
+			},
+		})
+		defer w.Stop()
+		w.repollFunc = func(int) (bool, time.Duration) {
+			return true, 10 * time.Millisecond
+		}
+		n := fakeNotifier("foo")
+		w.Register(n)
+		// the failures follow its first data, so it is cached meanwhile
+		d := &flakyDep{FakeDep: idep.FakeDep{Name: "flaky"}, failures: 2,
+			bare: bare}
+		w.Recaller(n)(d)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var failed bool
+		for {
+			if err := w.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if ctx.Err() != nil {
+				t.Fatal("timeout")
+			}
+			if len(w.Errors()) > 0 {
+				failed = true
+			} else if failed {
+				break
+			}
+		}
+		// polled again after failing, it received new data
+		if data, _ := w.cache.Recall(d.ID()); data.(uint64) < 2 {
+			t.Errorf("expected new data, got %v", data)
+		}
+	}
+	t.Run("recovered", func(t *testing.T) { recovered(t, false) })
+	// a dependency's FetchError without an ID is routed to its view
+	t.Run("recovered bare fetch error", func(t *testing.T) { recovered(t, true) })
+}
+
+// optsDep records the clients and options of its last fetch
+type optsDep struct {
+	idep.FakeDep
+	mux     sync.Mutex
+	clients dep.Clients
+	opts    dep.QueryOptions
+}
+
+func (d *optsDep) SetOptions(opts dep.QueryOptions) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.opts = opts
+}
+
+func (d *optsDep) Fetch(c dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.clients = c
+	return d.FakeDep.Fetch(c)
+}
+
+func (d *optsDep) last() (dep.Clients, dep.QueryOptions) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.clients, d.opts
+}
+
+func TestWatcherReconfigure(t *testing.T) {
+	t.Run("settings", func(t *testing.T) {
+		c1, c2 := NewClientSet(), NewClientSet()
+		w := NewWatcher(WatcherInput{Clients: c1, ConsulBlockWait: time.Second})
+		defer w.Stop()
+		n := fakeNotifier("foo")
+		w.Register(n)
+		d := &optsDep{FakeDep: idep.FakeDep{Name: "foo"}}
+		w.Recaller(n)(d)
+		if err := waitData(t, w); err != nil {
+			t.Fatal(err)
+		}
+
+		w.Reconfigure(WatcherInput{
+			Clients:         c2,
+			ConsulBlockWait: 2 * time.Second,
+			ConsulMaxStale:  time.Minute,
+		})
+		if w.Clients() != c2 {
+			t.Error("expected the clients to be swapped")
+		}
+
+		// the fake dependency fetches continuously, so it picks them up
+		deadline := time.Now().Add(time.Second)
+		for {
+			clients, opts := d.last()
+			if clients == c2 && opts.WaitTime == 2*time.Second && opts.AllowStale {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("settings not applied: %v %+v", clients, opts)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		if _, ok := w.cache.Recall(d.ID()); !ok || w.Size() != 1 {
+			t.Error("expected the cache and views to be kept")
+		}
+		// the default retry function, as before
+		v := w.tracker.view(d.ID())
+		if retry, sleep := v.retryFunc(0); !retry || sleep > time.Second {
+			t.Error("expected the default retry function")
+		}
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		pool, c1, c2 := NewViewPool(), NewClientSet(), NewClientSet()
+		w := newPoolWatcher(pool, c1)
+		defer w.Stop()
+		n := fakeNotifier("foo")
+		w.Register(n)
+		d := &idep.FakeDep{Name: "foo"}
+		w.Recaller(n)(d)
+		v := w.tracker.view(d.ID())
+
+		w.Reconfigure(WatcherInput{Clients: c2, ConsulBlockWait: time.Second})
+		if w.tracker.view(d.ID()) != v || v.shared.key.clients != c1 {
+			t.Error("expected the shared view to be kept")
+		}
+		if v.blockWaitTime != 0 || v.shared.view.blockWaitTime != 0 {
+			t.Error("shared views are configured by the pool")
+		}
+
+		// tracked anew, it uses the new clients
+		w.MarkForSweep(n)
+		w.Sweep(n)
+		w.Recaller(n)(d)
+		if v := w.tracker.view(d.ID()); v.shared.key.clients != c2 {
+			t.Error("expected a shared view for the new clients")
+		}
+	})
+}
+
 func TestWatcherWatch(t *testing.T) {
 	t.Run("ctx-handling", func(t *testing.T) {
 		testCases := []struct {
@@ -891,6 +1331,44 @@ func TestWatcherWatch(t *testing.T) {
 }
 
 func TestWatcherNotify(t *testing.T) {
+	t.Run("rate-limit", func(t *testing.T) {
+		suppressed := make(chan events.RenderSuppressed, 1)
+		N := 1
+		w := NewWatcher(WatcherInput{
+			Clients:        NewClientSet(),
+			DataBufferSize: &N,
+			EventHandler: func(e events.Event) {
+				if e, ok := e.(events.RenderSuppressed); ok {
+					suppressed <- e
+				}
+			},
+		})
+		defer w.Stop()
+		w.bufferTimers.testSetRateLimit(time.Hour, 1, "foo")
+
+		foodep := &idep.FakeDep{Name: "foo"}
+		n := fakeNotifier("foo")
+		w.Register(n)
+		w.dataCh <- w.track(n, foodep)
+		if err := w.Wait(context.Background()); err != nil {
+			t.Fatalf("first wait should have returned nil, got: %v\n", err)
+		}
+
+		w.dataCh <- w.track(n, foodep)
+		ctx, cc := context.WithCancel(context.Background())
+		go func() { time.Sleep(time.Millisecond); cc() }()
+		if err := w.Wait(ctx); err != context.Canceled {
+			t.Fatalf("wait should have been rate limited, got: %v", err)
+		}
+		select {
+		case e := <-suppressed:
+			if e.ID != "foo" || e.Delay <= 0 {
+				t.Errorf("bad suppressed event: %+v", e)
+			}
+		default:
+			t.Error("expected a RenderSuppressed event")
+		}
+	})
 	t.Run("single-notify-true", func(t *testing.T) {
 		w := newWatcher(1)
 		defer w.Stop()
@@ -1067,6 +1545,43 @@ func TestWatcherMarkSweep(t *testing.T) {
 			t.Errorf("expected *no* cache for '%v'", bdep.ID())
 		}
 	})
+	t.Run("shared-dependency", func(t *testing.T) {
+		w := newWatcher()
+		defer w.Stop()
+		fdep := &idep.FakeDep{Name: "foo"}
+		bdep := &idep.FakeDep{Name: "bar"}
+		n0, n1 := fakeNotifier("zed"), fakeNotifier("zod")
+		w.Register(n0, n1)
+		w.track(n0, fdep)
+		w.track(n0, bdep)
+		w.track(n1, fdep)
+
+		// n0 stops using both, fdep is kept for n1
+		w.MarkForSweep(n0)
+		w.Sweep(n0)
+		if !w.Watching(fdep.ID()) {
+			t.Error("expected shared dependency foo to still be watched")
+		}
+		if w.Watching(bdep.ID()) {
+			t.Error("expected dependency bar to no longer be watched")
+		}
+		if len(w.tracker.tracked) != 1 || len(w.tracker.byView) != 1 ||
+			len(w.tracker.byNotifier) != 1 {
+			t.Errorf("expected only n1's pair to be indexed: %#v", w.tracker)
+		}
+		if ns := w.tracker.notifiersFor(fdep); len(ns) != 1 || ns[0] != n1 {
+			t.Errorf("unexpected notifiers for foo: %v", ns)
+		}
+		if !w.Complete(n0) {
+			t.Error("notifier without dependencies should be complete")
+		}
+
+		w.MarkForSweep(n1)
+		w.Sweep(n1)
+		if w.Size() != 0 || len(w.tracker.tracked) != 0 {
+			t.Errorf("expected all views removed: %#v", w.tracker)
+		}
+	})
 }
 
 func newWatcher(bufsize ...int) *Watcher {